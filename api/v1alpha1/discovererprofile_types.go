@@ -0,0 +1,124 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DiscovererProfileSpec defines how targets matching the capability rules are discovered
+type DiscovererProfileSpec struct {
+	// vendor type set in the discovery info of the discovered targets
+	VendorType string `json:"vendorType"`
+
+	// profiles with a higher priority are consulted first
+	// +kubebuilder:default:=0
+	Priority int `json:"priority,omitempty"`
+
+	// the profile is used if any of the capability match rules
+	// matches a model advertised by the target
+	// +kubebuilder:validation:MinItems=1
+	Match []CapabilityMatch `json:"match"`
+
+	// encoding of the gNMI Get requests
+	// +kubebuilder:validation:Enum=JSON;JSON_IETF;ASCII;PROTO;BYTES
+	// +kubebuilder:default:="JSON"
+	Encoding string `json:"encoding,omitempty"`
+
+	// target set in the prefix of the gNMI Get requests
+	Target string `json:"target,omitempty"`
+
+	// gNMI paths of the discovery info fields
+	Paths DiscoveryInfoPaths `json:"paths"`
+}
+
+// CapabilityMatch matches a model advertised in a gNMI capabilities response,
+// all the set fields must match.
+type CapabilityMatch struct {
+	// model organization
+	Organization string `json:"organization,omitempty"`
+	// regular expression matching the model name
+	ModelName string `json:"modelName,omitempty"`
+}
+
+// DiscoveryInfoPaths maps the discovery info fields to gNMI paths
+type DiscoveryInfoPaths struct {
+	HostName     *PathValue `json:"hostname,omitempty"`
+	Platform     *PathValue `json:"platform,omitempty"`
+	MacAddress   *PathValue `json:"macAddress,omitempty"`
+	SerialNumber *PathValue `json:"serialNumber,omitempty"`
+	SwVersion    *PathValue `json:"swVersion,omitempty"`
+}
+
+// PathValue is a gNMI path and the way its value is extracted
+type PathValue struct {
+	// gNMI path, optionally prefixed by an origin e.g. openconfig:/system/state/hostname
+	Path string `json:"path"`
+	// how the value is extracted from the Get response,
+	// string_val uses the scalar value, json decodes the JSON or JSON_IETF value
+	// +kubebuilder:validation:Enum=string_val;json
+	// +kubebuilder:default:="string_val"
+	Value ValueType `json:"value,omitempty"`
+	// selector applied to the decoded JSON value, e.g. .state.serial-no or .component[0].name
+	Selector string `json:"selector,omitempty"`
+}
+
+type ValueType string
+
+const (
+	ValueTypeStringVal ValueType = "string_val"
+	ValueTypeJSON      ValueType = "json"
+)
+
+// DiscovererProfileStatus defines the observed state of DiscovererProfile
+type DiscovererProfileStatus struct {
+	// conditions of the discoverer profile: Ready is False when its match rules or paths are invalid
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="VENDOR-TYPE",type="string",JSONPath=".spec.vendorType",description="Vendor type of the discovered targets"
+// +kubebuilder:printcolumn:name="PRIORITY",type="integer",JSONPath=".spec.priority",description="Profiles with a higher priority are consulted first"
+// +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status",description="False if the profile match rules or paths are invalid"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DiscovererProfile is the Schema for the discovererprofiles API
+type DiscovererProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DiscovererProfileSpec   `json:"spec,omitempty"`
+	Status DiscovererProfileStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DiscovererProfileList contains a list of DiscovererProfile
+type DiscovererProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DiscovererProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DiscovererProfile{}, &DiscovererProfileList{})
+}
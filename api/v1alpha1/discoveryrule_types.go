@@ -18,15 +18,30 @@ package v1alpha1
 
 import (
 	"bytes"
+	"errors"
+	"strings"
 	"text/template"
 
 	targetv1 "github.com/yndd/target/apis/target/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
-	LabelKeyDiscoveryRule = "discovery.yndd.io/discovery-rule"
-	LabelKeyVendorType    = "discovery.yndd.io/vendor-type"
+	LabelKeyDiscoveryRule          = "discovery.yndd.io/discovery-rule"
+	LabelKeyDiscoveryRuleNamespace = "discovery.yndd.io/discovery-rule-namespace"
+	LabelKeyVendorType             = "discovery.yndd.io/vendor-type"
+
+	// FieldManager is the server-side apply field manager of the targets written by discovery
+	FieldManager = "discovery.yndd.io"
+
+	// AnnotationKeyStale is set on targets that were not reachable
+	// for a number of consecutive discovery rule runs
+	AnnotationKeyStale = "discovery.yndd.io/stale"
+
+	// AnnotationKeyRunNow requests an immediate run of the discovery rule when its value,
+	// e.g. a timestamp, differs from the last handled one
+	AnnotationKeyRunNow = "discovery.yndd.io/run-now"
 )
 
 // DiscoveryRuleSpec defines the desired state of DiscoveryRule
@@ -39,22 +54,68 @@ type DiscoveryRuleSpec struct {
 	// +kubebuilder:default:="1m"
 	Period metav1.Duration `json:"period,omitempty"`
 
-	// gNMI, netconf
+	// maximum random delay added to the period or the scheduled time, spreads
+	// the runs of the discovery rules sharing the same period or schedule
+	Jitter *metav1.Duration `json:"jitter,omitempty"`
+
+	// maximum duration of a run, the discoveries still in progress
+	// when it expires are aborted. Runs are not bounded if not set
+	RunTimeout *metav1.Duration `json:"runTimeout,omitempty"`
+
+	// cron schedule of the discovery rule runs, in the standard 5 fields format
+	// or a descriptor such as @daily. A CRON_TZ=<zone> prefix sets its time zone,
+	// the controller one is used otherwise. Period is ignored when set
+	Schedule string `json:"schedule,omitempty"`
+
+	// recurring windows during which the discovery rule does not run,
+	// a run still in progress when a window opens is aborted
+	BlackoutWindows []BlackoutWindow `json:"blackoutWindows,omitempty"`
+
+	// gNMI, netconf or snmp, only Nokia SR OS devices are discovered with netconf
 	Protocol string `json:"protocol,omitempty"`
 
-	// Port is the gNMI port number
-	// +kubebuilder:default:=57400
+	// Port is the gNMI or NETCONF port number,
+	// with the snmp protocol it is the gNMI port set in the discovered targets.
+	// Defaults to 830 with the netconf protocol, 57400 otherwise.
 	Port uint `json:"port,omitempty"`
 
 	// secret name where the credentials used to access the target are stored
 	Credentials string `json:"credentials,omitempty"`
 
+	// credential secrets tried in order after Credentials until one gives access to the target,
+	// the credentials that worked are set in the discovered target
+	CredentialsList []CredentialsRef `json:"credentialsList,omitempty"`
+
 	// Insecure connection
 	Insecure bool `json:"insecure,omitempty"`
 
-	// certificate Name
+	// name of the TLS secret used to connect to the targets, the CA (ca.crt) verifies
+	// the target certificate and the client certificate (tls.crt, tls.key) is optional.
+	// The secret name is set as the TLS credential of the discovered targets,
+	// it is ignored with an insecure connection.
 	Certificate string `json:"certificate,omitempty"`
 
+	// server name used to verify the target certificate, defaults to the target address
+	ServerName string `json:"serverName,omitempty"`
+
+	// SNMP parameters used with the snmp protocol
+	SNMP *SNMPConfig `json:"snmp,omitempty"`
+
+	// pins the gNMI discoverer used for the discovered targets, skipping vendor detection,
+	// either a built-in discoverer name (e.g. nokia-srl, arista-eos) or a DiscovererProfile name
+	Discoverer string `json:"discoverer,omitempty"`
+
+	// fields of the existing targets reconciled on rediscovery: All reconciles the target config,
+	// labels and annotations with the discovered ones, DiscoveryInfo only updates the discovery info
+	// +kubebuilder:validation:Enum=All;DiscoveryInfo
+	// +kubebuilder:default:="All"
+	SyncPolicy SyncPolicy `json:"syncPolicy,omitempty"`
+
+	// deletes the targets created by the rule when the rule is deleted, through an owner reference.
+	// Owner references cannot cross namespaces, targets created in another namespace
+	// than the rule one are only labeled with the rule name and namespace.
+	CascadeDelete bool `json:"cascadeDelete,omitempty"`
+
 	// target template
 	TargetTemplate *TargetTemplate `json:"targetTemplate,omitempty"`
 	// IP range discovery rule
@@ -63,28 +124,142 @@ type DiscoveryRuleSpec struct {
 	APIRule *APIRule `json:"apiRule,omitempty"`
 	// Topology discovery rule
 	TopologyRule *TopologyRule `json:"topologyRule,omitempty"`
-	// NetBox Type
+	// NetBox discovery rule
+	NetBoxRule *NetBoxRule `json:"netBoxRule,omitempty"`
+	// Consul discovery rule
+	ConsulRule *ConsulRule `json:"consulRule,omitempty"`
+}
+
+// CredentialsRef references a credentials secret,
+// optionally restricted to the targets matching its selectors.
+type CredentialsRef struct {
+	// secret name where the credentials are stored
+	Name string `json:"name"`
+	// the credentials are only tried on the IP addresses within one of the CIDRs
+	CIDRs []string `json:"cidrs,omitempty"`
+	// the credentials are only used for the targets of one of the vendor types
+	VendorTypes []targetv1.VendorType `json:"vendorTypes,omitempty"`
+}
 
-	// Consul Type
+// BlackoutWindow is a recurring period during which the discovery rule does not run.
+type BlackoutWindow struct {
+	// cron schedule of the window openings, e.g. "0 22 * * 5" for Fridays at 22:00
+	Start string `json:"start"`
+	// length of the window
+	Duration metav1.Duration `json:"duration"`
+}
+
+// SNMPConfig holds the SNMP parameters, the community (v2c) or the USM username
+// and passphrases (v3) are read from the credentials secret.
+type SNMPConfig struct {
+	// SNMP version
+	// +kubebuilder:validation:Enum=v2c;v3
+	// +kubebuilder:default:="v2c"
+	Version string `json:"version,omitempty"`
+	// SNMP agent UDP port
+	// +kubebuilder:default:=161
+	Port uint `json:"port,omitempty"`
+	// SNMPv3 security level
+	// +kubebuilder:validation:Enum=noAuthNoPriv;authNoPriv;authPriv
+	// +kubebuilder:default:="authPriv"
+	SecurityLevel string `json:"securityLevel,omitempty"`
+	// SNMPv3 authentication protocol
+	// +kubebuilder:validation:Enum=MD5;SHA;SHA224;SHA256;SHA384;SHA512
+	// +kubebuilder:default:="SHA"
+	AuthProtocol string `json:"authProtocol,omitempty"`
+	// SNMPv3 privacy protocol
+	// +kubebuilder:validation:Enum=DES;AES;AES192;AES256;AES192C;AES256C
+	// +kubebuilder:default:="AES"
+	PrivProtocol string `json:"privProtocol,omitempty"`
+	// secret name where the SNMP community (v2c) or username, authPassphrase and privPassphrase (v3)
+	// are stored. The discovery rule credentials are then the gNMI credentials set in the discovered
+	// targets, they are used for SNMP and set in the targets when it is not set
+	Credentials string `json:"credentials,omitempty"`
 }
 
 type IPRangeRule struct {
-	// list of CIDR(s) to be scanned
+	// list of IPv4 or IPv6 CIDR(s) to be scanned
 	CIDRs []string `json:"cidrs,omitempty"`
-	// IP CIDR(s) to be excluded
+	// list of address ranges to be scanned, e.g. 10.0.0.10-10.0.0.20
+	Ranges []string `json:"ranges,omitempty"`
+	// IP CIDR(s), address ranges or addresses to be excluded
 	Excludes []string `json:"excludes,omitempty"`
+	// skips the network and broadcast addresses of the IPv4 CIDRs,
+	// and the subnet-router anycast address of the IPv6 CIDRs
+	SkipNetworkAndBroadcast bool `json:"skipNetworkAndBroadcast,omitempty"`
+	// maximum number of addresses scanned, the rule fails if its ranges hold more
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=65536
+	MaxHosts int64 `json:"maxHosts,omitempty"`
 	// number of concurrent IP scan
 	ConcurrentScans int64 `json:"concurrentScans,omitempty"`
+	// reachability check run on every IP before the discovery,
+	// the IPs failing it are counted as unreachable
+	// +optional
+	PreCheck *PreCheck `json:"preCheck,omitempty"`
+	// action taken on the targets created by this rule
+	// that were not reachable for StaleThreshold consecutive scans
+	// +kubebuilder:validation:Enum=delete;mark;ignore
+	// +kubebuilder:default:="ignore"
+	StaleTargetPolicy StaleTargetPolicy `json:"staleTargetPolicy,omitempty"`
+	// number of consecutive scans a target is not reachable
+	// before the stale target policy is applied
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=3
+	StaleThreshold int `json:"staleThreshold,omitempty"`
+}
+
+type SyncPolicy string
+
+const (
+	// SyncPolicyAll makes discovery own the target config, labels, annotations and discovery info
+	SyncPolicyAll SyncPolicy = "All"
+	// SyncPolicyDiscoveryInfo only updates the discovery info of existing targets
+	SyncPolicyDiscoveryInfo SyncPolicy = "DiscoveryInfo"
+)
+
+// PreCheck is a lightweight reachability check filtering the live hosts of an IP range.
+// A host is live if it accepts a TCP connection on the discovery rule port,
+// or answers an ICMP echo request when enabled. The TCP check is not run with the snmp protocol.
+type PreCheck struct {
+	// disables the pre-check, every IP is discovered
+	Disabled bool `json:"disabled,omitempty"`
+	// timeout of the TCP connection and of the ICMP echo request
+	// +kubebuilder:default:="1s"
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// also sends an ICMP echo request, which requires the NET_RAW capability
+	ICMP bool `json:"icmp,omitempty"`
 }
 
+type StaleTargetPolicy string
+
+const (
+	// StaleTargetPolicyDelete deletes stale targets
+	StaleTargetPolicyDelete StaleTargetPolicy = "delete"
+	// StaleTargetPolicyMark annotates stale targets
+	StaleTargetPolicyMark StaleTargetPolicy = "mark"
+	// StaleTargetPolicyIgnore leaves stale targets untouched
+	StaleTargetPolicyIgnore StaleTargetPolicy = "ignore"
+)
+
 type APIRule struct {
-	URL               string            `json:"url,omitempty"`
-	Method            string            `json:"method,omitempty"`
-	ResponseTemplate  string            `json:"responseTemplate,omitempty"`
-	APIInsecure       bool              `json:"insecure,omitempty"`
-	CheckReachability bool              `json:"checkReachability,omitempty"`
-	Headers           map[string]string `json:"headers,omitempty"`
+	// URL of the inventory API
+	URL string `json:"url,omitempty"`
+	// HTTP method used to query the API
+	// +kubebuilder:default:="GET"
+	Method string `json:"method,omitempty"`
+	// go template rendered against the JSON response body,
+	// it should output a list of IP addresses separated by whitespace or commas
+	ResponseTemplate string `json:"responseTemplate,omitempty"`
+	// skip verification of the API server certificate
+	APIInsecure bool `json:"insecure,omitempty"`
+	// check that the target port is reachable before discovering an address,
+	// the port is not checked with the snmp protocol
+	CheckReachability bool `json:"checkReachability,omitempty"`
+	// HTTP headers added to the API request
+	Headers map[string]string `json:"headers,omitempty"`
 	// TODO: should become a struct with username/password and/or token
+	// bearer token added to the API request
 	OAuth string `json:"oauth,omitempty"`
 }
 
@@ -95,11 +270,47 @@ type TopologyRule struct {
 	Name string `json:"name,omitempty"`
 }
 
+type NetBoxRule struct {
+	// URL of the NetBox instance
+	URL string `json:"url,omitempty"`
+	// secret name where the NetBox API token is stored, under the token key
+	TokenSecret string `json:"tokenSecret,omitempty"`
+	// skip verification of the NetBox server certificate
+	Insecure bool `json:"insecure,omitempty"`
+	// site slug(s) used to filter devices
+	Sites []string `json:"sites,omitempty"`
+	// device role slug(s) used to filter devices
+	Roles []string `json:"roles,omitempty"`
+	// tag slug(s) used to filter devices
+	Tags []string `json:"tags,omitempty"`
+	// platform slug(s) used to filter devices
+	Platforms []string `json:"platforms,omitempty"`
+	// number of devices requested per page
+	// +kubebuilder:default:=100
+	PageSize int `json:"pageSize,omitempty"`
+}
+
+type ConsulRule struct {
+	// address of the Consul agent or server, e.g https://consul.example.com:8501
+	Address string `json:"address,omitempty"`
+	// Consul datacenter, defaults to the datacenter of the agent
+	Datacenter string `json:"datacenter,omitempty"`
+	// name of the service whose instances are discovered
+	Service string `json:"service,omitempty"`
+	// only instances carrying all the tag(s) are discovered
+	Tags []string `json:"tags,omitempty"`
+	// secret name where the Consul ACL token is stored, under the token key
+	TokenSecret string `json:"tokenSecret,omitempty"`
+	// skip verification of the Consul server certificate
+	Insecure bool `json:"insecure,omitempty"`
+}
+
 type TargetTemplate struct {
 	// target namespace
 	Namespace string `json:"namespace,omitempty"`
 
-	// target name template
+	// target name template rendered with the target spec, e.g. {{ .DiscoveryInfo.HostName }},
+	// the result is converted into a valid object name. Defaults to hostname.serial-number.mac-address
 	NameTemplate string `json:"nameTemplate,omitempty"`
 
 	// Annotations is a key value map to be copied to the target CR.
@@ -113,8 +324,89 @@ type TargetTemplate struct {
 
 // DiscoveryRuleStatus defines the observed state of DiscoveryRule
 type DiscoveryRuleStatus struct {
-	StartTime int64  `json:"startTime,omitempty"`
-	Type      string `json:"type,omitempty"`
+	StartTime int64 `json:"startTime,omitempty"`
+	// type of the running discovery rule
+	// +kubebuilder:validation:Enum=ipRange;topoWatch;apiRule;netbox;consul
+	Type string `json:"type,omitempty"`
+
+	// generation of the spec the running discovery rule was started with
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// conditions of the discovery rule: Ready, Running and Degraded
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// result of the last discovery rule run
+	// +optional
+	LastRun *RunStatus `json:"lastRun,omitempty"`
+
+	// time of the next scheduled discovery rule run
+	// +optional
+	NextRunTime *metav1.Time `json:"nextRunTime,omitempty"`
+
+	// value of the last run now annotation handled by the discovery rule
+	// +optional
+	RunNowTrigger string `json:"runNowTrigger,omitempty"`
+}
+
+const (
+	// ConditionTypeReady indicates the discovery rule implementation is started
+	ConditionTypeReady = "Ready"
+	// ConditionTypeRunning indicates a discovery rule run is in progress
+	ConditionTypeRunning = "Running"
+	// ConditionTypeDegraded indicates the last discovery rule run had failures
+	ConditionTypeDegraded = "Degraded"
+)
+
+// RunStatus reports the result of a discovery rule run
+type RunStatus struct {
+	// time the run started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// time the run ended
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+	// duration of the run
+	Duration metav1.Duration `json:"duration,omitempty"`
+
+	// number of hosts scanned
+	HostsScanned int64 `json:"hostsScanned,omitempty"`
+	// number of hosts that answered the discovery protocol
+	HostsReachable int64 `json:"hostsReachable,omitempty"`
+	// number of hosts successfully discovered
+	HostsDiscovered int64 `json:"hostsDiscovered,omitempty"`
+	// number of hosts that failed the reachability pre-check or did not answer the discovery protocol
+	HostsUnreachable int64 `json:"hostsUnreachable,omitempty"`
+	// number of hosts whose discovery failed
+	HostsFailed int64 `json:"hostsFailed,omitempty"`
+	// number of hosts that rejected all the credentials, included in the failed hosts
+	HostsAuthFailed int64 `json:"hostsAuthFailed,omitempty"`
+	// number of hosts of an unknown vendor, included in the failed hosts
+	HostsUnknownVendor int64 `json:"hostsUnknownVendor,omitempty"`
+
+	// number of targets created
+	TargetsCreated int64 `json:"targetsCreated,omitempty"`
+	// number of targets updated
+	TargetsUpdated int64 `json:"targetsUpdated,omitempty"`
+	// number of targets deleted
+	TargetsDeleted int64 `json:"targetsDeleted,omitempty"`
+	// number of targets not applied because of a conflict with another field manager
+	TargetsConflicting int64 `json:"targetsConflicting,omitempty"`
+
+	// last per-host errors
+	// +optional
+	Errors []HostError `json:"errors,omitempty"`
+}
+
+// HostError is a discovery error for a single host
+type HostError struct {
+	// host address
+	Host string `json:"host,omitempty"`
+	// error message
+	Error string `json:"error,omitempty"`
+	// time the error occurred
+	Time metav1.Time `json:"time,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -123,6 +415,10 @@ type DiscoveryRuleStatus struct {
 // +kubebuilder:printcolumn:name="PROTOCOL",type="string",JSONPath=".spec.protocol",description="Protocol used discover the target"
 // +kubebuilder:printcolumn:name="PERIOD",type="string",JSONPath=".spec.period",description="Wait period between discovery rule runs"
 // +kubebuilder:printcolumn:name="CREDENTIALS",type="string",JSONPath=".spec.credentials",description="Secret name where the credentials used to access the target are stored"
+// +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status",description="True if the discovery rule is running"
+// +kubebuilder:printcolumn:name="DEGRADED",type="string",JSONPath=".status.conditions[?(@.type=='Degraded')].status",description="True if the last discovery rule run had failures"
+// +kubebuilder:printcolumn:name="DISCOVERED",type="integer",JSONPath=".status.lastRun.hostsDiscovered",description="Number of hosts discovered during the last run"
+// +kubebuilder:printcolumn:name="LAST-RUN",type="date",JSONPath=".status.lastRun.endTime",description="Time the last run ended"
 // DiscoveryRule is the Schema for the discoveryrules API
 type DiscoveryRule struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -196,3 +492,79 @@ func (dr *DiscoveryRule) buildTags(m map[string]string, t *targetv1.TargetSpec)
 	}
 	return labels, nil
 }
+
+// GetTargetName returns the name of the target, rendered from the name template if set.
+// It falls back to the default name when the template renders an empty name,
+// and to the target address when the discovery info has none of the default name fields.
+func (dr *DiscoveryRule) GetTargetName(t *targetv1.TargetSpec) (string, error) {
+	if dr.Spec.TargetTemplate != nil && dr.Spec.TargetTemplate.NameTemplate != "" {
+		tpl, err := template.New("name").Parse(dr.Spec.TargetTemplate.NameTemplate)
+		if err != nil {
+			return "", err
+		}
+		b := new(bytes.Buffer)
+		err = tpl.Execute(b, t)
+		if err != nil {
+			return "", err
+		}
+		if name := sanitizeName(b.String()); name != "" {
+			return name, nil
+		}
+	}
+	if name := sanitizeName(defaultTargetName(t.DiscoveryInfo)); name != "" {
+		return name, nil
+	}
+	if t.Properties != nil && t.Properties.Config != nil {
+		if name := sanitizeName(t.Properties.Config.Address); name != "" {
+			return name, nil
+		}
+	}
+	return "", errors.New("cannot name the target, no discovery info nor address")
+}
+
+// defaultTargetName joins the hostname, serial number and MAC address,
+// not all protocols return every field, the empty ones are left out of the name
+func defaultTargetName(di *targetv1.DiscoveryInfo) string {
+	if di == nil {
+		return ""
+	}
+	// some devices append the part number to the serial number
+	var serialNumber string
+	if fields := strings.Fields(di.SerialNumber); len(fields) > 0 {
+		serialNumber = fields[0]
+	}
+	parts := make([]string, 0, 3)
+	for _, p := range []string{di.HostName, serialNumber, di.MacAddress} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// sanitizeName converts s into a DNS-1123 subdomain: lower case alphanumeric segments
+// separated by dots, where any other character is replaced by a dash.
+// It returns an empty string if nothing valid is left.
+func sanitizeName(s string) string {
+	segments := strings.Split(strings.ToLower(s), ".")
+	valid := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		seg = strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '-'
+		}, seg)
+		if seg = strings.Trim(seg, "-"); seg != "" {
+			valid = append(valid, seg)
+		}
+	}
+	name := strings.Join(valid, ".")
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		name = strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength], "-.")
+	}
+	if len(validation.IsDNS1123Subdomain(name)) != 0 {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,94 @@
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+
+	targetv1 "github.com/yndd/target/apis/target/v1"
+)
+
+func TestGetTargetName(t *testing.T) {
+	tests := []struct {
+		name         string
+		nameTemplate string
+		di           *targetv1.DiscoveryInfo
+		address      string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name: "default",
+			di:   &targetv1.DiscoveryInfo{HostName: "Leaf1", SerialNumber: "ABC123 PART-1", MacAddress: "00:1C:73:AA:BB:CC"},
+			want: "leaf1.abc123.00-1c-73-aa-bb-cc",
+		},
+		{
+			name: "default without serial number",
+			di:   &targetv1.DiscoveryInfo{HostName: "leaf1", MacAddress: "00:1c:73:aa:bb:cc"},
+			want: "leaf1.00-1c-73-aa-bb-cc",
+		},
+		{
+			name:    "default without discovery info fields",
+			di:      &targetv1.DiscoveryInfo{},
+			address: "10.0.0.1:57400",
+			want:    "10.0.0.1-57400",
+		},
+		{
+			name:         "template",
+			nameTemplate: "{{ .Properties.VendorType }}-{{ .DiscoveryInfo.HostName }}",
+			di:           &targetv1.DiscoveryInfo{HostName: "spine_1", VendorType: targetv1.VendorTypeNokiaSRL},
+			want:         "nokiasrl-spine-1",
+		},
+		{
+			name:         "template rendering an empty name",
+			nameTemplate: "{{ .DiscoveryInfo.HostName }}",
+			di:           &targetv1.DiscoveryInfo{SerialNumber: "ABC123"},
+			want:         "abc123",
+		},
+		{
+			name:         "template with invalid characters",
+			nameTemplate: "-{{ .DiscoveryInfo.HostName }}..{{ .DiscoveryInfo.SerialNumber }}.",
+			di:           &targetv1.DiscoveryInfo{HostName: "Router #1", SerialNumber: "SN/42"},
+			want:         "router--1.sn-42",
+		},
+		{
+			name:         "invalid template",
+			nameTemplate: "{{ .DiscoveryInfo.HostName",
+			di:           &targetv1.DiscoveryInfo{HostName: "leaf1"},
+			wantErr:      true,
+		},
+		{
+			name:    "nothing to name the target after",
+			di:      &targetv1.DiscoveryInfo{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dr := &DiscoveryRule{}
+			if tt.nameTemplate != "" {
+				dr.Spec.TargetTemplate = &TargetTemplate{NameTemplate: tt.nameTemplate}
+			}
+			spec := &targetv1.TargetSpec{
+				Properties: &targetv1.TargetProperties{
+					VendorType: tt.di.VendorType,
+					Config:     &targetv1.TargetConfig{Address: tt.address},
+				},
+				DiscoveryInfo: tt.di,
+			}
+			got, err := dr.GetTargetName(spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got name %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeNameLength(t *testing.T) {
+	got := sanitizeName(strings.Repeat("a", 250) + ".-bcd")
+	if len(got) > 253 || strings.HasSuffix(got, ".") || strings.HasSuffix(got, "-") {
+		t.Errorf("invalid name %q", got)
+	}
+}
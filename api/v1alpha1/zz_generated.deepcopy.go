@@ -22,6 +22,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -47,13 +49,231 @@ func (in *APIRule) DeepCopy() *APIRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlackoutWindow) DeepCopyInto(out *BlackoutWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlackoutWindow.
+func (in *BlackoutWindow) DeepCopy() *BlackoutWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(BlackoutWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapabilityMatch) DeepCopyInto(out *CapabilityMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapabilityMatch.
+func (in *CapabilityMatch) DeepCopy() *CapabilityMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(CapabilityMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsulRule) DeepCopyInto(out *ConsulRule) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsulRule.
+func (in *ConsulRule) DeepCopy() *ConsulRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsulRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsRef) DeepCopyInto(out *CredentialsRef) {
+	*out = *in
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.VendorTypes != nil {
+		in, out := &in.VendorTypes, &out.VendorTypes
+		*out = make([]targetv1.VendorType, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsRef.
+func (in *CredentialsRef) DeepCopy() *CredentialsRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscovererProfile) DeepCopyInto(out *DiscovererProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscovererProfile.
+func (in *DiscovererProfile) DeepCopy() *DiscovererProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscovererProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DiscovererProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscovererProfileList) DeepCopyInto(out *DiscovererProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DiscovererProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscovererProfileList.
+func (in *DiscovererProfileList) DeepCopy() *DiscovererProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscovererProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DiscovererProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscovererProfileSpec) DeepCopyInto(out *DiscovererProfileSpec) {
+	*out = *in
+	if in.Match != nil {
+		in, out := &in.Match, &out.Match
+		*out = make([]CapabilityMatch, len(*in))
+		copy(*out, *in)
+	}
+	in.Paths.DeepCopyInto(&out.Paths)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscovererProfileSpec.
+func (in *DiscovererProfileSpec) DeepCopy() *DiscovererProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscovererProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscovererProfileStatus) DeepCopyInto(out *DiscovererProfileStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscovererProfileStatus.
+func (in *DiscovererProfileStatus) DeepCopy() *DiscovererProfileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscovererProfileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscoveryInfoPaths) DeepCopyInto(out *DiscoveryInfoPaths) {
+	*out = *in
+	if in.HostName != nil {
+		in, out := &in.HostName, &out.HostName
+		*out = new(PathValue)
+		**out = **in
+	}
+	if in.Platform != nil {
+		in, out := &in.Platform, &out.Platform
+		*out = new(PathValue)
+		**out = **in
+	}
+	if in.MacAddress != nil {
+		in, out := &in.MacAddress, &out.MacAddress
+		*out = new(PathValue)
+		**out = **in
+	}
+	if in.SerialNumber != nil {
+		in, out := &in.SerialNumber, &out.SerialNumber
+		*out = new(PathValue)
+		**out = **in
+	}
+	if in.SwVersion != nil {
+		in, out := &in.SwVersion, &out.SwVersion
+		*out = new(PathValue)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveryInfoPaths.
+func (in *DiscoveryInfoPaths) DeepCopy() *DiscoveryInfoPaths {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscoveryInfoPaths)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DiscoveryRule) DeepCopyInto(out *DiscoveryRule) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveryRule.
@@ -110,6 +330,33 @@ func (in *DiscoveryRuleList) DeepCopyObject() runtime.Object {
 func (in *DiscoveryRuleSpec) DeepCopyInto(out *DiscoveryRuleSpec) {
 	*out = *in
 	out.Period = in.Period
+	if in.Jitter != nil {
+		in, out := &in.Jitter, &out.Jitter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RunTimeout != nil {
+		in, out := &in.RunTimeout, &out.RunTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.BlackoutWindows != nil {
+		in, out := &in.BlackoutWindows, &out.BlackoutWindows
+		*out = make([]BlackoutWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialsList != nil {
+		in, out := &in.CredentialsList, &out.CredentialsList
+		*out = make([]CredentialsRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SNMP != nil {
+		in, out := &in.SNMP, &out.SNMP
+		*out = new(SNMPConfig)
+		**out = **in
+	}
 	if in.TargetTemplate != nil {
 		in, out := &in.TargetTemplate, &out.TargetTemplate
 		*out = new(TargetTemplate)
@@ -130,6 +377,16 @@ func (in *DiscoveryRuleSpec) DeepCopyInto(out *DiscoveryRuleSpec) {
 		*out = new(TopologyRule)
 		**out = **in
 	}
+	if in.NetBoxRule != nil {
+		in, out := &in.NetBoxRule, &out.NetBoxRule
+		*out = new(NetBoxRule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConsulRule != nil {
+		in, out := &in.ConsulRule, &out.ConsulRule
+		*out = new(ConsulRule)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveryRuleSpec.
@@ -145,6 +402,22 @@ func (in *DiscoveryRuleSpec) DeepCopy() *DiscoveryRuleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DiscoveryRuleStatus) DeepCopyInto(out *DiscoveryRuleStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastRun != nil {
+		in, out := &in.LastRun, &out.LastRun
+		*out = new(RunStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextRunTime != nil {
+		in, out := &in.NextRunTime, &out.NextRunTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveryRuleStatus.
@@ -157,6 +430,22 @@ func (in *DiscoveryRuleStatus) DeepCopy() *DiscoveryRuleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostError) DeepCopyInto(out *HostError) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostError.
+func (in *HostError) DeepCopy() *HostError {
+	if in == nil {
+		return nil
+	}
+	out := new(HostError)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPRangeRule) DeepCopyInto(out *IPRangeRule) {
 	*out = *in
@@ -165,11 +454,21 @@ func (in *IPRangeRule) DeepCopyInto(out *IPRangeRule) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Ranges != nil {
+		in, out := &in.Ranges, &out.Ranges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Excludes != nil {
 		in, out := &in.Excludes, &out.Excludes
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PreCheck != nil {
+		in, out := &in.PreCheck, &out.PreCheck
+		*out = new(PreCheck)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPRangeRule.
@@ -182,6 +481,122 @@ func (in *IPRangeRule) DeepCopy() *IPRangeRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetBoxRule) DeepCopyInto(out *NetBoxRule) {
+	*out = *in
+	if in.Sites != nil {
+		in, out := &in.Sites, &out.Sites
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Platforms != nil {
+		in, out := &in.Platforms, &out.Platforms
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetBoxRule.
+func (in *NetBoxRule) DeepCopy() *NetBoxRule {
+	if in == nil {
+		return nil
+	}
+	out := new(NetBoxRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PathValue) DeepCopyInto(out *PathValue) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PathValue.
+func (in *PathValue) DeepCopy() *PathValue {
+	if in == nil {
+		return nil
+	}
+	out := new(PathValue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreCheck) DeepCopyInto(out *PreCheck) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreCheck.
+func (in *PreCheck) DeepCopy() *PreCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(PreCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunStatus) DeepCopyInto(out *RunStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EndTime != nil {
+		in, out := &in.EndTime, &out.EndTime
+		*out = (*in).DeepCopy()
+	}
+	out.Duration = in.Duration
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]HostError, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunStatus.
+func (in *RunStatus) DeepCopy() *RunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SNMPConfig) DeepCopyInto(out *SNMPConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SNMPConfig.
+func (in *SNMPConfig) DeepCopy() *SNMPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SNMPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetTemplate) DeepCopyInto(out *TargetTemplate) {
 	*out = *in
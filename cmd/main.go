@@ -106,6 +106,14 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "DiscoveryRule")
 		os.Exit(1)
 	}
+	if err = (&controllers.DiscovererProfileReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Logger: logging.NewLogrLogger(logger),
+	}).SetupWithManager(mgr, o); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DiscovererProfile")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
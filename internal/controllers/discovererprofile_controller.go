@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers/profile_discoverer"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+)
+
+// DiscovererProfileReconciler validates DiscovererProfile objects and reports the result
+// in their Ready condition, invalid profiles are skipped by the discovery.
+type DiscovererProfileReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Logger logging.Logger
+}
+
+//+kubebuilder:rbac:groups=discovery.yndd.io,resources=discovererprofiles/status,verbs=get;update;patch
+
+func (r *DiscovererProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Logger.WithValues("request", req)
+	logger.Debug("reconciling")
+
+	p := &discoveryv1alpha1.DiscovererProfile{}
+	err := r.Client.Get(ctx, req.NamespacedName, p)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	cond := metav1.Condition{
+		Type:               discoveryv1alpha1.ConditionTypeReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: p.GetGeneration(),
+		Reason:             "Valid",
+		Message:            "discoverer profile is valid",
+	}
+	if err := profile_discoverer.Validate(p); err != nil {
+		logger.Info("invalid discoverer profile", "error", err)
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "Invalid"
+		cond.Message = err.Error()
+	}
+	if c := meta.FindStatusCondition(p.Status.Conditions, cond.Type); c != nil &&
+		c.Status == cond.Status && c.Reason == cond.Reason &&
+		c.Message == cond.Message && c.ObservedGeneration == cond.ObservedGeneration {
+		return ctrl.Result{}, nil
+	}
+	meta.SetStatusCondition(&p.Status.Conditions, cond)
+	return ctrl.Result{}, r.Client.Status().Update(ctx, p)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DiscovererProfileReconciler) SetupWithManager(mgr ctrl.Manager, o controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&discoveryv1alpha1.DiscovererProfile{}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		WithOptions(o).
+		Complete(r)
+}
@@ -18,10 +18,13 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,7 +42,7 @@ func NewReconciler(ctx context.Context) *DiscoveryRuleReconciler {
 	return &DiscoveryRuleReconciler{
 		ctx:            ctx,
 		m:              new(sync.Mutex),
-		discoveryRules: make(map[string]discoveryrules.DiscoveryRule),
+		discoveryRules: make(map[string]*runningDiscoveryRule),
 	}
 }
 
@@ -51,12 +54,52 @@ type DiscoveryRuleReconciler struct {
 
 	ctx            context.Context
 	m              *sync.Mutex
-	discoveryRules map[string]discoveryrules.DiscoveryRule
+	discoveryRules map[string]*runningDiscoveryRule
+}
+
+// runningDiscoveryRule is a started discovery rule implementation
+type runningDiscoveryRule struct {
+	discoveryrules.DiscoveryRule
+	// generation of the DiscoveryRule spec the implementation was started with
+	generation int64
+	// cancels the context the implementation runs with
+	cfn context.CancelFunc
+	// closed when the Run method of the implementation returned
+	done chan struct{}
+	// run now requests sent to the implementation
+	trigger chan string
+	// last run now annotation value sent or handled
+	lastTrigger string
+}
+
+// stop cancels the context of the implementation rather than calling its Stop method,
+// which is not safe before the Run goroutine is scheduled. It waits for Run to return
+// so that a replacing implementation does not write the status and targets concurrently.
+func (rdr *runningDiscoveryRule) stop() {
+	rdr.cfn()
+	<-rdr.done
+}
+
+// runNow requests an immediate run of the implementation if the run now annotation
+// value was not already requested, replacing a request not yet handled.
+func (rdr *runningDiscoveryRule) runNow(dr *discoveryv1alpha1.DiscoveryRule) bool {
+	value := dr.GetAnnotations()[discoveryv1alpha1.AnnotationKeyRunNow]
+	if value == "" || value == rdr.lastTrigger {
+		return false
+	}
+	rdr.lastTrigger = value
+	select {
+	case <-rdr.trigger:
+	default:
+	}
+	rdr.trigger <- value
+	return true
 }
 
 //+kubebuilder:rbac:groups=discovery.yndd.io,resources=discoveryrules,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=discovery.yndd.io,resources=discoveryrules/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=discovery.yndd.io,resources=discoveryrules/finalizers,verbs=update
+//+kubebuilder:rbac:groups=discovery.yndd.io,resources=discovererprofiles,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -80,13 +123,14 @@ func (r *DiscoveryRuleReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			logger.Debug("discovery-rule not found")
 			r.m.Lock()
 			if oldDR, ok := r.discoveryRules[drFullName]; ok {
-				oldDR.Stop()
+				oldDR.stop()
 				delete(r.discoveryRules, drFullName)
 			}
 			r.m.Unlock()
 			return ctrl.Result{}, nil
 		}
 		logger.Debug("could not get discoveryRule", "error", err)
+		return ctrl.Result{}, err
 	}
 	drFullName = fmt.Sprintf("%s/%s", dr.GetNamespace(), dr.GetName())
 	logger = r.Logger.WithValues("discovery-rule", drFullName)
@@ -94,26 +138,92 @@ func (r *DiscoveryRuleReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	r.m.Lock()
 	defer r.m.Unlock()
 	if eDR, ok := r.discoveryRules[drFullName]; ok {
+		if dr.Spec.Enabled && eDR.generation == dr.GetGeneration() {
+			if eDR.runNow(dr) {
+				logger.Info("run now requested", "trigger", eDR.lastTrigger)
+			}
+			return ctrl.Result{}, nil
+		}
+		eDR.stop()
+		delete(r.discoveryRules, drFullName)
 		if !dr.Spec.Enabled {
-			eDR.Stop()
-			delete(r.discoveryRules, drFullName)
+			return ctrl.Result{}, r.setReady(ctx, dr, metav1.ConditionFalse, "Disabled", "discovery rule is disabled")
 		}
-		return ctrl.Result{}, nil
+		logger.Info("discovery rule spec changed, restarting", "generation", dr.GetGeneration())
+	}
+	if !dr.Spec.Enabled {
+		return ctrl.Result{}, r.setReady(ctx, dr, metav1.ConditionFalse, "Disabled", "discovery rule is disabled")
+	}
+	err = discoveryrules.ValidateSchedule(dr)
+	if err != nil {
+		return ctrl.Result{}, r.setReady(ctx, dr, metav1.ConditionFalse, "InvalidSchedule", err.Error())
 	}
 	// run discovery rule
 	drule := discoveryrules.Initialize(dr)
 	if drule == nil {
-		return ctrl.Result{}, fmt.Errorf("could not determine type of discovery rule %q", drFullName)
+		err = fmt.Errorf("could not determine type of discovery rule %q", drFullName)
+		if sErr := r.setReady(ctx, dr, metav1.ConditionFalse, "UnknownType", err.Error()); sErr != nil {
+			logger.Info("failed to update discovery rule status", "error", sErr)
+		}
+		return ctrl.Result{}, err
 	}
-	r.discoveryRules[drFullName] = drule
-	go drule.Run(r.ctx, dr, discoveryrules.WithLogger(logger), discoveryrules.WithClient(r.Client))
+	runCtx, cfn := context.WithCancel(r.ctx)
+	rdr := &runningDiscoveryRule{
+		DiscoveryRule: drule,
+		generation:    dr.GetGeneration(),
+		cfn:           cfn,
+		done:          make(chan struct{}),
+		trigger:       make(chan string, 1),
+		// a request handled before a restart is not run again
+		lastTrigger: dr.Status.RunNowTrigger,
+	}
+	r.discoveryRules[drFullName] = rdr
+	rdr.runNow(dr)
 
 	// update discovery rule start time
-	dr.Status.StartTime = time.Now().UnixNano()
-	err = r.Client.Status().Update(ctx, dr)
+	err = discoveryrules.UpdateStatus(ctx, r.Client, dr, func(status *discoveryv1alpha1.DiscoveryRuleStatus) {
+		status.StartTime = time.Now().UnixNano()
+		status.Type = discoveryrules.RuleType(dr)
+		status.ObservedGeneration = dr.GetGeneration()
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               discoveryv1alpha1.ConditionTypeReady,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: dr.GetGeneration(),
+			Reason:             "Started",
+			Message:            "discovery rule is running",
+		})
+	})
+	// started after the Ready condition is set, which a failure of the implementation overrides
+	go func() {
+		defer close(rdr.done)
+		runErr := drule.Run(runCtx, dr,
+			discoveryrules.WithLogger(logger),
+			discoveryrules.WithClient(r.Client),
+			discoveryrules.WithTrigger(rdr.trigger),
+		)
+		if runErr == nil || errors.Is(runErr, context.Canceled) {
+			return
+		}
+		logger.Info("discovery rule failed", "error", runErr)
+		if sErr := r.setReady(r.ctx, dr, metav1.ConditionFalse, "RunFailed", runErr.Error()); sErr != nil {
+			logger.Info("failed to update discovery rule status", "error", sErr)
+		}
+	}()
 	return ctrl.Result{}, err
 }
 
+func (r *DiscoveryRuleReconciler) setReady(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, status metav1.ConditionStatus, reason, msg string) error {
+	return discoveryrules.UpdateStatus(ctx, r.Client, dr, func(s *discoveryv1alpha1.DiscoveryRuleStatus) {
+		meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+			Type:               discoveryv1alpha1.ConditionTypeReady,
+			Status:             status,
+			ObservedGeneration: dr.GetGeneration(),
+			Reason:             reason,
+			Message:            msg,
+		})
+	})
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *DiscoveryRuleReconciler) SetupWithManager(mgr ctrl.Manager, o controller.Options) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -125,8 +235,10 @@ func (r *DiscoveryRuleReconciler) SetupWithManager(mgr ctrl.Manager, o controlle
 				// Generation is only updated on spec changes (also on deletion),
 				// not metadata or status
 				// Filter out events where the generation hasn't changed to
-				// avoid being triggered by status updates
-				return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
+				// avoid being triggered by status updates,
+				// except for run now requests which are set in an annotation
+				return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+					e.ObjectOld.GetAnnotations()[discoveryv1alpha1.AnnotationKeyRunNow] != e.ObjectNew.GetAnnotations()[discoveryv1alpha1.AnnotationKeyRunNow]
 			},
 			// DeleteFunc:  func(event.DeleteEvent) bool { return true },
 			// GenericFunc: func(event.GenericEvent) bool { return true },
@@ -1,6 +1,12 @@
 package all
 
 import (
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/arista_eos_discoverer"
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/cisco_iosxr_discoverer"
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/cisco_nxos_discoverer"
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/juniper_junos_discoverer"
 	_ "github.com/yndd/discovery/internal/discovery/discoverers/nokia_srl_discoverer"
 	_ "github.com/yndd/discovery/internal/discovery/discoverers/nokia_sros_discoverer"
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/openconfig_discoverer"
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/sonic_discoverer"
 )
@@ -0,0 +1,95 @@
+package arista_eos_discoverer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	eosSWVersionPath    = "components/component[name=EOS]/state/software-version"
+	eosChassisPath      = "components/component[name=Chassis]/state/part-no"
+	eosHostnamePath     = "system/state/hostname"
+	eosHWMacAddressPath = "lldp/state/chassis-id"
+	eosSerialNumberPath = "components/component[name=Chassis]/state/serial-no"
+)
+
+func init() {
+	discoverers.Register(discoverers.AristaEOSDiscovererName, func() discoverers.Discoverer {
+		return &eosDiscoverer{}
+	})
+}
+
+type eosDiscoverer struct{}
+
+func (s *eosDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return strings.HasPrefix(m.GetOrganization(), "Arista Networks") || strings.HasPrefix(m.GetName(), "arista-")
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
+func (s *eosDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	req, err := gapi.NewGetRequest(
+		gapi.Path(eosSWVersionPath),
+		gapi.Path(eosChassisPath),
+		gapi.Path(eosHWMacAddressPath),
+		gapi.Path(eosHostnamePath),
+		gapi.Path(eosSerialNumberPath),
+		gapi.EncodingJSON(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	di := &targetv1.DiscoveryInfo{
+		VendorType: discoverers.VendorTypeAristaEOS,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+	setDiscoveryInfo(di, resp)
+	return di, nil
+}
+
+// setDiscoveryInfo sets the discovery info fields from the Get response leaves
+func setDiscoveryInfo(di *targetv1.DiscoveryInfo, resp *gnmi.GetResponse) {
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			// the component keys are dropped, the leaf names are unique among the requested paths
+			switch discoverers.UpdatePath(notif.GetPrefix(), upd.GetPath()) {
+			case "components/component/state/software-version":
+				di.SwVersion = discoverers.StringValue(upd.GetVal())
+			case "components/component/state/part-no":
+				di.Platform = discoverers.StringValue(upd.GetVal())
+			case "components/component/state/serial-no":
+				di.SerialNumber = discoverers.StringValue(upd.GetVal())
+			case eosHWMacAddressPath:
+				di.MacAddress = discoverers.StringValue(upd.GetVal())
+			case eosHostnamePath:
+				di.HostName = discoverers.StringValue(upd.GetVal())
+			}
+		}
+	}
+}
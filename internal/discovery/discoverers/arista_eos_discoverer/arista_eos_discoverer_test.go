@@ -0,0 +1,83 @@
+package arista_eos_discoverer
+
+import (
+	"reflect"
+	"testing"
+
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+)
+
+func notification(t *testing.T, prefix, path string, val *gnmi.TypedValue) *gnmi.Notification {
+	n := &gnmi.Notification{}
+	if prefix != "" {
+		p, err := gutils.ParsePath(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Prefix = p
+	}
+	p, err := gutils.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Update = []*gnmi.Update{{Path: p, Val: val}}
+	return n
+}
+
+func jsonVal(s string) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonVal{JsonVal: []byte(s)}}
+}
+
+func stringVal(s string) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: s}}
+}
+
+func TestSetDiscoveryInfo(t *testing.T) {
+	want := targetv1.DiscoveryInfo{
+		HostName:     "leaf1",
+		Platform:     "DCS-7050SX3-48YC8",
+		MacAddress:   "00:1c:73:aa:bb:cc",
+		SerialNumber: "JPE12345678",
+		SwVersion:    "4.28.0F",
+	}
+	tests := []struct {
+		name   string
+		notifs func(t *testing.T) []*gnmi.Notification
+	}{
+		{
+			name: "JSON leaves",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, "", eosSWVersionPath, jsonVal(`"4.28.0F"`)),
+					notification(t, "", eosChassisPath, jsonVal(`"DCS-7050SX3-48YC8"`)),
+					notification(t, "", eosHWMacAddressPath, jsonVal(`"00:1c:73:aa:bb:cc"`)),
+					notification(t, "", eosHostnamePath, jsonVal(`"leaf1"`)),
+					notification(t, "", eosSerialNumberPath, jsonVal(`"JPE12345678"`)),
+				}
+			},
+		},
+		{
+			name: "prefixed module qualified paths",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, "openconfig-platform:components", "component[name=EOS]/state/software-version", stringVal("4.28.0F")),
+					notification(t, "openconfig-platform:components", "component[name=Chassis]/state/part-no", stringVal("DCS-7050SX3-48YC8")),
+					notification(t, "openconfig-platform:components", "component[name=Chassis]/state/serial-no", stringVal("JPE12345678")),
+					notification(t, "openconfig-lldp:lldp", "state/chassis-id", stringVal("00:1c:73:aa:bb:cc")),
+					notification(t, "openconfig-system:system", "state/hostname", stringVal("leaf1")),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := &targetv1.DiscoveryInfo{}
+			setDiscoveryInfo(di, &gnmi.GetResponse{Notification: tt.notifs(t)})
+			if !reflect.DeepEqual(*di, want) {
+				t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, want)
+			}
+		})
+	}
+}
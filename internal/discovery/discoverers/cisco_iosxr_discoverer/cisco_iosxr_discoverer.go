@@ -0,0 +1,92 @@
+package cisco_iosxr_discoverer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	iosxrSWVersionPath    = "Cisco-IOS-XR-install-oper:install/version/label"
+	iosxrChassisPath      = "openconfig-platform:components/component[name=Rack 0]/state/part-no"
+	iosxrHostnamePath     = "Cisco-IOS-XR-shellutil-oper:system-time/uptime/host-name"
+	iosxrHWMacAddressPath = "openconfig-lldp:lldp/state/chassis-id"
+	iosxrSerialNumberPath = "openconfig-platform:components/component[name=Rack 0]/state/serial-no"
+)
+
+func init() {
+	discoverers.Register(discoverers.CiscoIOSXRDiscovererName, func() discoverers.Discoverer {
+		return &iosxrDiscoverer{}
+	})
+}
+
+type iosxrDiscoverer struct{}
+
+func (s *iosxrDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return strings.HasPrefix(m.GetName(), "Cisco-IOS-XR-")
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
+func (s *iosxrDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	// IOS-XR only supports the JSON_IETF encoding in Get requests
+	req, err := gapi.NewGetRequest(
+		gapi.Path(iosxrSWVersionPath),
+		gapi.Path(iosxrChassisPath),
+		gapi.Path(iosxrHWMacAddressPath),
+		gapi.Path(iosxrHostnamePath),
+		gapi.Path(iosxrSerialNumberPath),
+		gapi.EncodingJSON_IETF(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	di := &targetv1.DiscoveryInfo{
+		VendorType: discoverers.VendorTypeCiscoIOSXR,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			for p, val := range discoverers.Leaves(notif.GetPrefix(), upd) {
+				switch p {
+				case "install/version/label":
+					di.SwVersion = val
+				case "components/component/state/part-no":
+					di.Platform = val
+				case "components/component/state/serial-no":
+					di.SerialNumber = val
+				case "lldp/state/chassis-id":
+					di.MacAddress = val
+				case "system-time/uptime/host-name":
+					di.HostName = val
+				}
+			}
+		}
+	}
+	return di, nil
+}
@@ -0,0 +1,135 @@
+package cisco_iosxr_discoverer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/karimra/gnmic/target"
+	"github.com/karimra/gnmic/types"
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"google.golang.org/grpc"
+)
+
+// gnmiClient answers the Capabilities and Get RPCs with canned responses
+type gnmiClient struct {
+	gnmi.GNMIClient
+	capRsp *gnmi.CapabilityResponse
+	getRsp *gnmi.GetResponse
+}
+
+func (c *gnmiClient) Capabilities(ctx context.Context, in *gnmi.CapabilityRequest, opts ...grpc.CallOption) (*gnmi.CapabilityResponse, error) {
+	return c.capRsp, nil
+}
+
+func (c *gnmiClient) Get(ctx context.Context, in *gnmi.GetRequest, opts ...grpc.CallOption) (*gnmi.GetResponse, error) {
+	return c.getRsp, nil
+}
+
+func update(t *testing.T, path, val string) *gnmi.Update {
+	p, err := gutils.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gnmi.Update{Path: p, Val: &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}}}
+}
+
+var iosxrCapabilities = &gnmi.CapabilityResponse{
+	SupportedModels: []*gnmi.ModelData{
+		{Name: "openconfig-platform", Organization: "OpenConfig working group"},
+		{Name: "Cisco-IOS-XR-install-oper", Organization: "Cisco Systems, Inc."},
+	},
+	SupportedEncodings: []gnmi.Encoding{gnmi.Encoding_JSON_IETF, gnmi.Encoding_ASCII},
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		capRsp *gnmi.CapabilityResponse
+		want   int
+	}{
+		{name: "IOS-XR models", capRsp: iosxrCapabilities, want: discoverers.MaxScore},
+		{
+			name: "OpenConfig models only",
+			capRsp: &gnmi.CapabilityResponse{SupportedModels: []*gnmi.ModelData{
+				{Name: "openconfig-platform", Organization: "OpenConfig working group"},
+			}},
+			want: 0,
+		},
+		{
+			name: "NX-OS models",
+			capRsp: &gnmi.CapabilityResponse{SupportedModels: []*gnmi.ModelData{
+				{Name: "Cisco-NX-OS-device", Organization: "Cisco Systems, Inc."},
+			}},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		if got := (&iosxrDiscoverer{}).Detect(tt.capRsp); got != tt.want {
+			t.Errorf("%s: got score %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	want := targetv1.DiscoveryInfo{
+		VendorType:         discoverers.VendorTypeCiscoIOSXR,
+		HostName:           "xr1",
+		Platform:           "NCS-5501-SE",
+		MacAddress:         "00:8a:96:11:22:33",
+		SerialNumber:       "FOC2222R0AB",
+		SwVersion:          "7.5.2",
+		SupportedEncodings: []string{"JSON_IETF", "ASCII"},
+	}
+	tests := []struct {
+		name    string
+		updates func(t *testing.T) []*gnmi.Update
+	}{
+		{
+			name: "leaves",
+			updates: func(t *testing.T) []*gnmi.Update {
+				return []*gnmi.Update{
+					update(t, iosxrSWVersionPath, `"7.5.2"`),
+					update(t, iosxrChassisPath, `"NCS-5501-SE"`),
+					update(t, iosxrHWMacAddressPath, `"00:8a:96:11:22:33"`),
+					update(t, iosxrHostnamePath, `"xr1"`),
+					update(t, iosxrSerialNumberPath, `"FOC2222R0AB"`),
+				}
+			},
+		},
+		{
+			name: "containers",
+			updates: func(t *testing.T) []*gnmi.Update {
+				return []*gnmi.Update{
+					update(t, "Cisco-IOS-XR-install-oper:install/version", `{"label":"7.5.2","copyright-info":"Cisco Systems, Inc."}`),
+					update(t, "openconfig-platform:components/component[name=Rack 0]/state", `{"part-no":"NCS-5501-SE","serial-no":"FOC2222R0AB"}`),
+					update(t, "openconfig-lldp:lldp/state", `{"chassis-id":"00:8a:96:11:22:33","chassis-id-type":"MAC_ADDRESS"}`),
+					update(t, "Cisco-IOS-XR-shellutil-oper:system-time/uptime", `{"host-name":"xr1","uptime":1234}`),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tg := &target.Target{
+				Config: &types.TargetConfig{Name: "xr1"},
+				Client: &gnmiClient{
+					capRsp: iosxrCapabilities,
+					getRsp: &gnmi.GetResponse{Notification: []*gnmi.Notification{{Update: tt.updates(t)}}},
+				},
+			}
+			di, err := (&iosxrDiscoverer{}).Discover(context.Background(), &discoveryv1alphav1.DiscoveryRule{}, tg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want.LastSeen = di.LastSeen
+			if !reflect.DeepEqual(*di, want) {
+				t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package cisco_nxos_discoverer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// NX-OS native (device model) paths
+	nxosSWVersionPath    = "device:/System/showversion-items/nxosVersion"
+	nxosChassisPath      = "device:/System/ch-items/model"
+	nxosHostnamePath     = "device:/System/name"
+	nxosSerialNumberPath = "device:/System/ch-items/serNum"
+	// the base MAC address is not part of the device model
+	nxosHWMacAddressPath = "openconfig:/lldp/state/chassis-id"
+)
+
+func init() {
+	discoverers.Register(discoverers.CiscoNXOSDiscovererName, func() discoverers.Discoverer {
+		return &nxosDiscoverer{}
+	})
+}
+
+type nxosDiscoverer struct{}
+
+func (s *nxosDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return strings.HasPrefix(m.GetName(), "Cisco-NX-OS-")
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
+func (s *nxosDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	// NX-OS only supports the JSON encoding and
+	// does not accept paths with different origins in the same request
+	req, err := gapi.NewGetRequest(
+		gapi.Path(nxosSWVersionPath),
+		gapi.Path(nxosChassisPath),
+		gapi.Path(nxosHostnamePath),
+		gapi.Path(nxosSerialNumberPath),
+		gapi.EncodingJSON(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	di := &targetv1.DiscoveryInfo{
+		VendorType: discoverers.VendorTypeCiscoNXOS,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+	notifs := resp.GetNotification()
+
+	macReq, err := gapi.NewGetRequest(
+		gapi.Path(nxosHWMacAddressPath),
+		gapi.EncodingJSON(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// the OpenConfig LLDP model is only available with the openconfig feature enabled,
+	// the MAC address is left empty if the request fails
+	macResp, err := t.Get(ctx, macReq)
+	if err == nil {
+		notifs = append(notifs, macResp.GetNotification()...)
+	}
+	for _, notif := range notifs {
+		for _, upd := range notif.GetUpdate() {
+			for p, val := range discoverers.Leaves(notif.GetPrefix(), upd) {
+				switch p {
+				case "System/showversion-items/nxosVersion":
+					di.SwVersion = val
+				case "System/ch-items/model":
+					di.Platform = val
+				case "System/ch-items/serNum":
+					di.SerialNumber = val
+				case "lldp/state/chassis-id":
+					di.MacAddress = val
+				case "System/name":
+					di.HostName = val
+				}
+			}
+		}
+	}
+	return di, nil
+}
@@ -0,0 +1,163 @@
+package cisco_nxos_discoverer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/karimra/gnmic/target"
+	"github.com/karimra/gnmic/types"
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gnmiClient answers the Capabilities and Get RPCs with canned responses,
+// the Get responses are indexed by the origin of the first requested path
+type gnmiClient struct {
+	gnmi.GNMIClient
+	capRsp *gnmi.CapabilityResponse
+	getRsp map[string]*gnmi.GetResponse
+}
+
+func (c *gnmiClient) Capabilities(ctx context.Context, in *gnmi.CapabilityRequest, opts ...grpc.CallOption) (*gnmi.CapabilityResponse, error) {
+	return c.capRsp, nil
+}
+
+func (c *gnmiClient) Get(ctx context.Context, in *gnmi.GetRequest, opts ...grpc.CallOption) (*gnmi.GetResponse, error) {
+	if in.GetEncoding() != gnmi.Encoding_JSON {
+		return nil, status.Errorf(codes.Unimplemented, "unsupported encoding %s", in.GetEncoding())
+	}
+	rsp, ok := c.getRsp[in.GetPath()[0].GetOrigin()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unsupported origin")
+	}
+	return rsp, nil
+}
+
+func notification(t *testing.T, path, val string) *gnmi.Notification {
+	p, err := gutils.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the origin is set in the prefix of the notification
+	prefix := &gnmi.Path{Origin: p.GetOrigin()}
+	p.Origin = ""
+	return &gnmi.Notification{
+		Prefix: prefix,
+		Update: []*gnmi.Update{{Path: p, Val: &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonVal{JsonVal: []byte(val)}}}},
+	}
+}
+
+var nxosCapabilities = &gnmi.CapabilityResponse{
+	SupportedModels: []*gnmi.ModelData{
+		{Name: "Cisco-NX-OS-device", Organization: "Cisco Systems, Inc."},
+		{Name: "openconfig-lldp", Organization: "OpenConfig working group"},
+	},
+	SupportedEncodings: []gnmi.Encoding{gnmi.Encoding_JSON},
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		capRsp *gnmi.CapabilityResponse
+		want   int
+	}{
+		{name: "NX-OS models", capRsp: nxosCapabilities, want: discoverers.MaxScore},
+		{
+			name: "IOS-XR models",
+			capRsp: &gnmi.CapabilityResponse{SupportedModels: []*gnmi.ModelData{
+				{Name: "Cisco-IOS-XR-install-oper", Organization: "Cisco Systems, Inc."},
+			}},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		if got := (&nxosDiscoverer{}).Detect(tt.capRsp); got != tt.want {
+			t.Errorf("%s: got score %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	device := func(t *testing.T) *gnmi.GetResponse {
+		return &gnmi.GetResponse{Notification: []*gnmi.Notification{
+			notification(t, nxosSWVersionPath, `"9.3(8)"`),
+			notification(t, nxosChassisPath, `"N9K-C93180YC-FX"`),
+			notification(t, nxosHostnamePath, `"nx1"`),
+			notification(t, nxosSerialNumberPath, `"FDO22101ABC"`),
+		}}
+	}
+	tests := []struct {
+		name   string
+		getRsp func(t *testing.T) map[string]*gnmi.GetResponse
+		want   targetv1.DiscoveryInfo
+	}{
+		{
+			name: "openconfig enabled",
+			getRsp: func(t *testing.T) map[string]*gnmi.GetResponse {
+				return map[string]*gnmi.GetResponse{
+					"device": device(t),
+					"openconfig": {Notification: []*gnmi.Notification{
+						notification(t, nxosHWMacAddressPath, `"00:3a:9c:aa:bb:cc"`),
+					}},
+				}
+			},
+			want: targetv1.DiscoveryInfo{
+				VendorType:         discoverers.VendorTypeCiscoNXOS,
+				HostName:           "nx1",
+				Platform:           "N9K-C93180YC-FX",
+				MacAddress:         "00:3a:9c:aa:bb:cc",
+				SerialNumber:       "FDO22101ABC",
+				SwVersion:          "9.3(8)",
+				SupportedEncodings: []string{"JSON"},
+			},
+		},
+		{
+			name: "openconfig disabled",
+			getRsp: func(t *testing.T) map[string]*gnmi.GetResponse {
+				return map[string]*gnmi.GetResponse{"device": device(t)}
+			},
+			want: targetv1.DiscoveryInfo{
+				VendorType:         discoverers.VendorTypeCiscoNXOS,
+				HostName:           "nx1",
+				Platform:           "N9K-C93180YC-FX",
+				SerialNumber:       "FDO22101ABC",
+				SwVersion:          "9.3(8)",
+				SupportedEncodings: []string{"JSON"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tg := &target.Target{
+				Config: &types.TargetConfig{Name: "nx1"},
+				Client: &gnmiClient{capRsp: nxosCapabilities, getRsp: tt.getRsp(t)},
+			}
+			di, err := (&nxosDiscoverer{}).Discover(context.Background(), &discoveryv1alphav1.DiscoveryRule{}, tg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.LastSeen = di.LastSeen
+			if !reflect.DeepEqual(*di, tt.want) {
+				t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverGetError(t *testing.T) {
+	tg := &target.Target{
+		Config: &types.TargetConfig{Name: "nx1"},
+		Client: &gnmiClient{capRsp: nxosCapabilities},
+	}
+	_, err := (&nxosDiscoverer{}).Discover(context.Background(), &discoveryv1alphav1.DiscoveryRule{}, tg)
+	if err == nil {
+		t.Error("expected the error of the device model Get request")
+	}
+}
@@ -0,0 +1,60 @@
+package discoverers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	_ "github.com/yndd/discovery/internal/discovery/discoverers/all"
+)
+
+func capabilities(models ...*gnmi.ModelData) *gnmi.CapabilityResponse {
+	return &gnmi.CapabilityResponse{SupportedModels: models}
+}
+
+func TestDetect(t *testing.T) {
+	ocSystem := &gnmi.ModelData{Name: "openconfig-system", Organization: "OpenConfig working group"}
+	ocPlatform := &gnmi.ModelData{Name: "openconfig-platform", Organization: "OpenConfig working group"}
+	tests := []struct {
+		name   string
+		capRsp *gnmi.CapabilityResponse
+		want   string
+	}{
+		{
+			name: "srl advertising a Nokia model before srl_nokia ones",
+			capRsp: capabilities(
+				&gnmi.ModelData{Name: "nokia-conf", Organization: "Nokia"},
+				&gnmi.ModelData{Name: "urn:srl_nokia/system:srl_nokia-system", Organization: "Nokia"},
+			),
+			want: "*nokia_srl_discoverer.srlDiscoverer",
+		},
+		{
+			name:   "sros",
+			capRsp: capabilities(&gnmi.ModelData{Name: "nokia-conf", Organization: "Nokia"}, ocSystem, ocPlatform),
+			want:   "*nokia_sros_discoverer.srosDiscoverer",
+		},
+		{
+			name:   "openconfig models listed before the vendor models",
+			capRsp: capabilities(ocSystem, ocPlatform, &gnmi.ModelData{Name: "arista-exp-eos", Organization: "Arista Networks, Inc."}),
+			want:   "*arista_eos_discoverer.eosDiscoverer",
+		},
+		{
+			name:   "openconfig fallback",
+			capRsp: capabilities(ocPlatform, ocSystem),
+			want:   "*openconfig_discoverer.ocDiscoverer",
+		},
+		{
+			name:   "unknown",
+			capRsp: capabilities(ocSystem),
+			want:   "<nil>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprintf("%T", discoverers.Detect(tt.capRsp)); got != tt.want {
+				t.Errorf("Detect() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
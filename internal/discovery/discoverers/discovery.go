@@ -2,20 +2,31 @@ package discoverers
 
 import (
 	"context"
+	"sort"
 
 	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
 	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
 	targetv1 "github.com/yndd/target/apis/target/v1"
 )
 
 const (
-	NokiaSRLDiscovererName  = "nokia-srl"
-	NokiaSROSDiscovererName = "nokia-sros"
+	NokiaSRLDiscovererName     = "nokia-srl"
+	NokiaSROSDiscovererName    = "nokia-sros"
+	AristaEOSDiscovererName    = "arista-eos"
+	JuniperJunosDiscovererName = "juniper-junos"
+	CiscoIOSXRDiscovererName   = "cisco-iosxr"
+	CiscoNXOSDiscovererName    = "cisco-nxos"
+	SONiCDiscovererName        = "sonic"
+	OpenConfigDiscovererName   = "openconfig"
 )
 
 // Discoverer discovers the target and returns discoveryInfo such as chassis type, SW version,
 // SerialNumber, etc
 type Discoverer interface {
+	// Detect returns the confidence, from 0 to MaxScore, that the target advertising
+	// the capabilities is handled by the discoverer, 0 means the target is not supported
+	Detect(capRsp *gnmi.CapabilityResponse) int
 	// Discover
 	Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error)
 }
@@ -27,3 +38,22 @@ var Discoverers = map[string]Initializer{}
 func Register(name string, initFn Initializer) {
 	Discoverers[name] = initFn
 }
+
+// Detect returns the registered discoverer with the highest Detect score for the capabilities,
+// nil if none supports the target. Ties are broken by discoverer name.
+func Detect(capRsp *gnmi.CapabilityResponse) Discoverer {
+	names := make([]string, 0, len(Discoverers))
+	for name := range Discoverers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var best Discoverer
+	var bestScore int
+	for _, name := range names {
+		d := Discoverers[name]()
+		if score := d.Detect(capRsp); score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,145 @@
+package discoverers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gapi "github.com/karimra/gnmic/api"
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// UpdatePath returns the path of an update prefixed with the notification prefix,
+// without keys, origin nor module names, e.g. components/component/state/serial-no
+func UpdatePath(prefix, p *gnmi.Path) string {
+	elems := gutils.PathElems(prefix, p)
+	names := make([]string, 0, len(elems))
+	for _, e := range elems {
+		names = append(names, trimModule(e.GetName()))
+	}
+	return strings.Join(names, "/")
+}
+
+// trimModule removes the module name prefixing a JSON_IETF member or path element name
+func trimModule(name string) string {
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// ComponentName returns the name key of the component list element
+// in the path of an update, if any.
+func ComponentName(prefix, p *gnmi.Path) string {
+	for _, e := range gutils.PathElems(prefix, p) {
+		if e.GetName() == "component" {
+			return e.GetKey()["name"]
+		}
+	}
+	return ""
+}
+
+// Detect scores
+const (
+	// the target is certainly handled by the discoverer
+	MaxScore = 100
+	// the discoverer supports the target through standard models
+	FallbackScore = 10
+)
+
+// HasModel checks if the target supports a model for which match returns true
+func HasModel(capRsp *gnmi.CapabilityResponse, match func(m *gnmi.ModelData) bool) bool {
+	for _, m := range capRsp.GetSupportedModels() {
+		if match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONEncoding returns the JSON_IETF encoding option if the target supports it, JSON otherwise
+func JSONEncoding(capRsp *gnmi.CapabilityResponse) gapi.GNMIOption {
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		if enc == gnmi.Encoding_JSON_IETF {
+			return gapi.EncodingJSON_IETF()
+		}
+	}
+	return gapi.EncodingJSON()
+}
+
+// StringValue returns the value of a leaf as a string,
+// JSON encoded strings are unquoted.
+func StringValue(tv *gnmi.TypedValue) string {
+	switch v := tv.GetValue().(type) {
+	case *gnmi.TypedValue_StringVal:
+		return v.StringVal
+	case *gnmi.TypedValue_AsciiVal:
+		return v.AsciiVal
+	case *gnmi.TypedValue_JsonVal:
+		return jsonString(v.JsonVal)
+	case *gnmi.TypedValue_JsonIetfVal:
+		return jsonString(v.JsonIetfVal)
+	case *gnmi.TypedValue_IntVal:
+		return fmt.Sprint(v.IntVal)
+	case *gnmi.TypedValue_UintVal:
+		return fmt.Sprint(v.UintVal)
+	}
+	return ""
+}
+
+// Leaves returns the leaf values of an update indexed by their path (see UpdatePath).
+// JSON and JSON_IETF encoded containers are walked down to their leaves, the module
+// names prefixing JSON_IETF member names are removed. The first entry of a list wins.
+func Leaves(prefix *gnmi.Path, upd *gnmi.Update) map[string]string {
+	p := UpdatePath(prefix, upd.GetPath())
+	leaves := make(map[string]string)
+	var b []byte
+	switch v := upd.GetVal().GetValue().(type) {
+	case *gnmi.TypedValue_JsonVal:
+		b = v.JsonVal
+	case *gnmi.TypedValue_JsonIetfVal:
+		b = v.JsonIetfVal
+	default:
+		leaves[p] = StringValue(upd.GetVal())
+		return leaves
+	}
+	var val interface{}
+	if err := json.Unmarshal(b, &val); err != nil {
+		leaves[p] = jsonString(b)
+		return leaves
+	}
+	flatten(p, val, leaves)
+	return leaves
+}
+
+func flatten(p string, v interface{}, leaves map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, vv := range v {
+			k = trimModule(k)
+			if p != "" {
+				k = p + "/" + k
+			}
+			flatten(k, vv, leaves)
+		}
+	case []interface{}:
+		for _, vv := range v {
+			flatten(p, vv, leaves)
+		}
+	case nil:
+	default:
+		if _, ok := leaves[p]; ok {
+			return
+		}
+		leaves[p] = fmt.Sprint(v)
+	}
+}
+
+func jsonString(b []byte) string {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		return s
+	}
+	return strings.Trim(string(b), "\"")
+}
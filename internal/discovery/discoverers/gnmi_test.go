@@ -0,0 +1,80 @@
+package discoverers
+
+import (
+	"reflect"
+	"testing"
+
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func mustParsePath(t *testing.T, p string) *gnmi.Path {
+	gp, err := gutils.ParsePath(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gp
+}
+
+func TestLeaves(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		path   string
+		val    *gnmi.TypedValue
+		want   map[string]string
+	}{
+		{
+			name: "string leaf",
+			path: "system/state/hostname",
+			val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "r1"}},
+			want: map[string]string{"system/state/hostname": "r1"},
+		},
+		{
+			name:   "JSON leaf with prefix",
+			prefix: "system",
+			path:   "state/hostname",
+			val:    &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonVal{JsonVal: []byte(`"r1"`)}},
+			want:   map[string]string{"system/state/hostname": "r1"},
+		},
+		{
+			name: "module prefixed path",
+			path: "Cisco-IOS-XR-shellutil-oper:system-time/uptime/host-name",
+			val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`"xr1"`)}},
+			want: map[string]string{"system-time/uptime/host-name": "xr1"},
+		},
+		{
+			name: "JSON_IETF container",
+			path: "components/component[name=Chassis]/state",
+			val: &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(
+				`{"openconfig-platform:serial-no":"JN123","description":"MX240","openconfig-platform:type":"openconfig-platform-types:CHASSIS"}`,
+			)}},
+			want: map[string]string{
+				"components/component/state/serial-no":   "JN123",
+				"components/component/state/description": "MX240",
+				"components/component/state/type":        "openconfig-platform-types:CHASSIS",
+			},
+		},
+		{
+			name: "JSON list keeps the first entry",
+			path: "components",
+			val: &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonVal{JsonVal: []byte(
+				`{"component":[{"state":{"serial-no":"A"}},{"state":{"serial-no":"B"}}]}`,
+			)}},
+			want: map[string]string{"components/component/state/serial-no": "A"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prefix *gnmi.Path
+			if tt.prefix != "" {
+				prefix = mustParsePath(t, tt.prefix)
+				prefix.Origin = "openconfig"
+			}
+			got := Leaves(prefix, &gnmi.Update{Path: mustParsePath(t, tt.path), Val: tt.val})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package juniper_junos_discoverer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	junosChassisComponent = "Chassis"
+	junosREComponent      = "Routing Engine0"
+
+	junosSWVersionPath    = "components/component[name=Routing Engine0]/state/software-version"
+	junosChassisPath      = "components/component[name=Chassis]/state/description"
+	junosHostnamePath     = "system/state/hostname"
+	junosHWMacAddressPath = "lldp/state/chassis-id"
+	junosSerialNumberPath = "components/component[name=Chassis]/state/serial-no"
+)
+
+func init() {
+	discoverers.Register(discoverers.JuniperJunosDiscovererName, func() discoverers.Discoverer {
+		return &junosDiscoverer{}
+	})
+}
+
+type junosDiscoverer struct{}
+
+func (s *junosDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return strings.HasPrefix(m.GetOrganization(), "Juniper Networks") || strings.HasPrefix(m.GetName(), "junos-")
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
+func (s *junosDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := gapi.NewGetRequest(
+		gapi.Path(junosSWVersionPath),
+		gapi.Path(junosChassisPath),
+		gapi.Path(junosHWMacAddressPath),
+		gapi.Path(junosHostnamePath),
+		gapi.Path(junosSerialNumberPath),
+		// JSON_IETF is preferred by Junos
+		discoverers.JSONEncoding(capRsp),
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	di := &targetv1.DiscoveryInfo{
+		VendorType: discoverers.VendorTypeJuniperJunos,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			component := discoverers.ComponentName(notif.GetPrefix(), upd.GetPath())
+			// Junos may return the enclosing container instead of the requested leaf
+			for p, val := range discoverers.Leaves(notif.GetPrefix(), upd) {
+				switch {
+				case p == "components/component/state/software-version" && component == junosREComponent:
+					di.SwVersion = val
+				case p == "components/component/state/description" && component == junosChassisComponent:
+					di.Platform = val
+				case p == "components/component/state/serial-no" && component == junosChassisComponent:
+					di.SerialNumber = val
+				case p == junosHWMacAddressPath:
+					di.MacAddress = val
+				case p == junosHostnamePath:
+					di.HostName = val
+				}
+			}
+		}
+	}
+	return di, nil
+}
@@ -0,0 +1,133 @@
+package juniper_junos_discoverer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/karimra/gnmic/target"
+	"github.com/karimra/gnmic/types"
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"google.golang.org/grpc"
+)
+
+// gnmiClient answers the Capabilities and Get RPCs with canned responses
+// and records the encoding of the Get request
+type gnmiClient struct {
+	gnmi.GNMIClient
+	capRsp   *gnmi.CapabilityResponse
+	getRsp   *gnmi.GetResponse
+	encoding gnmi.Encoding
+}
+
+func (c *gnmiClient) Capabilities(ctx context.Context, in *gnmi.CapabilityRequest, opts ...grpc.CallOption) (*gnmi.CapabilityResponse, error) {
+	return c.capRsp, nil
+}
+
+func (c *gnmiClient) Get(ctx context.Context, in *gnmi.GetRequest, opts ...grpc.CallOption) (*gnmi.GetResponse, error) {
+	c.encoding = in.GetEncoding()
+	return c.getRsp, nil
+}
+
+func update(t *testing.T, path, val string) *gnmi.Update {
+	p, err := gutils.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gnmi.Update{Path: p, Val: &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}}}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		models []*gnmi.ModelData
+		want   int
+	}{
+		{name: "Juniper organization", models: []*gnmi.ModelData{{Name: "openconfig-platform", Organization: "OpenConfig working group"}, {Name: "configuration", Organization: "Juniper Networks, Inc."}}, want: discoverers.MaxScore},
+		{name: "junos model", models: []*gnmi.ModelData{{Name: "junos-conf-root"}}, want: discoverers.MaxScore},
+		{name: "OpenConfig models only", models: []*gnmi.ModelData{{Name: "openconfig-platform", Organization: "OpenConfig working group"}}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := (&junosDiscoverer{}).Detect(&gnmi.CapabilityResponse{SupportedModels: tt.models}); got != tt.want {
+			t.Errorf("%s: got score %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name         string
+		encodings    []gnmi.Encoding
+		updates      func(t *testing.T) []*gnmi.Update
+		wantEncoding gnmi.Encoding
+	}{
+		{
+			name:      "leaves",
+			encodings: []gnmi.Encoding{gnmi.Encoding_JSON, gnmi.Encoding_JSON_IETF, gnmi.Encoding_PROTO},
+			updates: func(t *testing.T) []*gnmi.Update {
+				return []*gnmi.Update{
+					update(t, junosSWVersionPath, `"21.4R1.12"`),
+					update(t, junosChassisPath, `"MX480"`),
+					update(t, junosHWMacAddressPath, `"2c:6b:f5:aa:bb:cc"`),
+					update(t, junosHostnamePath, `"mx1"`),
+					update(t, junosSerialNumberPath, `"JN11D2E3FAFA"`),
+				}
+			},
+			wantEncoding: gnmi.Encoding_JSON_IETF,
+		},
+		{
+			name:      "enclosing containers",
+			encodings: []gnmi.Encoding{gnmi.Encoding_JSON, gnmi.Encoding_PROTO},
+			updates: func(t *testing.T) []*gnmi.Update {
+				return []*gnmi.Update{
+					// the description and serial number of other components are ignored
+					update(t, "components/component[name=Routing Engine0]/state", `{"description":"RE-S-1800x4","serial-no":"9009185624","software-version":"21.4R1.12"}`),
+					update(t, "components/component[name=FPC0]/state", `{"description":"MPC7E 3D 40XGE","serial-no":"CAJT1234"}`),
+					update(t, "components/component[name=Chassis]/state", `{"openconfig-platform:description":"MX480","serial-no":"JN11D2E3FAFA","type":"openconfig-platform-types:CHASSIS"}`),
+					update(t, "lldp/state", `{"chassis-id":"2c:6b:f5:aa:bb:cc","chassis-id-type":"MAC_ADDRESS"}`),
+					update(t, "system/state", `{"hostname":"mx1","boot-time":"1654070400000000000"}`),
+				}
+			},
+			wantEncoding: gnmi.Encoding_JSON,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &gnmiClient{
+				capRsp: &gnmi.CapabilityResponse{
+					SupportedModels:    []*gnmi.ModelData{{Name: "junos-conf-root", Organization: "Juniper Networks, Inc."}},
+					SupportedEncodings: tt.encodings,
+				},
+				getRsp: &gnmi.GetResponse{Notification: []*gnmi.Notification{{Update: tt.updates(t)}}},
+			}
+			tg := &target.Target{Config: &types.TargetConfig{Name: "mx1"}, Client: c}
+			di, err := (&junosDiscoverer{}).Discover(context.Background(), &discoveryv1alphav1.DiscoveryRule{}, tg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.encoding != tt.wantEncoding {
+				t.Errorf("got Get request encoding %s, want %s", c.encoding, tt.wantEncoding)
+			}
+			want := targetv1.DiscoveryInfo{
+				VendorType:         discoverers.VendorTypeJuniperJunos,
+				HostName:           "mx1",
+				Platform:           "MX480",
+				MacAddress:         "2c:6b:f5:aa:bb:cc",
+				SerialNumber:       "JN11D2E3FAFA",
+				SwVersion:          "21.4R1.12",
+				LastSeen:           di.LastSeen,
+				SupportedEncodings: make([]string, 0, len(tt.encodings)),
+			}
+			for _, enc := range tt.encodings {
+				want.SupportedEncodings = append(want.SupportedEncodings, enc.String())
+			}
+			if !reflect.DeepEqual(*di, want) {
+				t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package discoverers
+
+import (
+	"context"
+
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/netconf"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+)
+
+// NetconfDiscoverer discovers the target over a NETCONF session and returns discoveryInfo
+// such as chassis type, SW version, SerialNumber, etc
+type NetconfDiscoverer interface {
+	// DiscoverNetconf
+	DiscoverNetconf(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, s *netconf.Session) (*targetv1.DiscoveryInfo, error)
+}
+
+type NetconfInitializer func() NetconfDiscoverer
+
+var NetconfDiscoverers = map[string]NetconfInitializer{}
+
+func RegisterNetconf(name string, initFn NetconfInitializer) {
+	NetconfDiscoverers[name] = initFn
+}
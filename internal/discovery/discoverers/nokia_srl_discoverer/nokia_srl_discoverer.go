@@ -2,11 +2,13 @@ package nokia_srl_discoverer
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	gapi "github.com/karimra/gnmic/api"
 	"github.com/karimra/gnmic/target"
 	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
 	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
 	"github.com/yndd/discovery/internal/discovery/discoverers"
 	targetv1 "github.com/yndd/target/apis/target/v1"
@@ -32,6 +34,15 @@ func init() {
 
 type srlDiscoverer struct{}
 
+func (s *srlDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return strings.Contains(m.GetName(), "srl_nokia")
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
 func (s *srlDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
 	req, err := gapi.NewGetRequest(
 		gapi.Path(srlSwVersionPath),
@@ -0,0 +1,69 @@
+package nokia_sros_discoverer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	"github.com/yndd/discovery/internal/discovery/netconf"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	srosStateNamespace = "urn:nokia.com:sros:ns:yang:sr:state"
+	// subtree filter selecting the same leaves as the gNMI paths
+	srosStateFilter = `<state xmlns="` + srosStateNamespace + `">` +
+		`<system><oper-name/><platform/><base-mac-address/><version><version-number/></version></system>` +
+		`<chassis><hardware-data><serial-number/></hardware-data></chassis>` +
+		`</state>`
+)
+
+func init() {
+	discoverers.RegisterNetconf(discoverers.NokiaSROSDiscovererName, func() discoverers.NetconfDiscoverer {
+		return &srosDiscoverer{}
+	})
+}
+
+type srosState struct {
+	XMLName xml.Name `xml:"urn:nokia.com:sros:ns:yang:sr:state state"`
+	System  struct {
+		OperName       string `xml:"oper-name"`
+		Platform       string `xml:"platform"`
+		BaseMacAddress string `xml:"base-mac-address"`
+		VersionNumber  string `xml:"version>version-number"`
+	} `xml:"system"`
+	Chassis []struct {
+		SerialNumber string `xml:"hardware-data>serial-number"`
+	} `xml:"chassis"`
+}
+
+func (s *srosDiscoverer) DiscoverNetconf(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, ns *netconf.Session) (*targetv1.DiscoveryInfo, error) {
+	b, err := ns.Get(ctx, srosStateFilter)
+	if err != nil {
+		return nil, err
+	}
+	state := new(srosState)
+	err = xml.Unmarshal(b, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SROS state: %w", err)
+	}
+	di := &targetv1.DiscoveryInfo{
+		VendorType: targetv1.VendorTypeNokiaSROS,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		HostName:   strings.TrimSpace(state.System.OperName),
+		Platform:   strings.TrimSpace(state.System.Platform),
+		MacAddress: strings.TrimSpace(state.System.BaseMacAddress),
+		SwVersion:  strings.TrimSpace(state.System.VersionNumber),
+	}
+	if len(state.Chassis) > 0 {
+		di.SerialNumber = strings.TrimSpace(state.Chassis[0].SerialNumber)
+	}
+	return di, nil
+}
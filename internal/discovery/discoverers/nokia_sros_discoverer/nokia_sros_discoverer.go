@@ -8,6 +8,7 @@ import (
 	gapi "github.com/karimra/gnmic/api"
 	"github.com/karimra/gnmic/target"
 	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
 	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
 	"github.com/yndd/discovery/internal/discovery/discoverers"
 	targetv1 "github.com/yndd/target/apis/target/v1"
@@ -30,6 +31,21 @@ func init() {
 
 type srosDiscoverer struct{}
 
+// Detect matches the Nokia models, except those of SR Linux
+func (s *srosDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return strings.Contains(m.GetName(), "srl_nokia")
+	}) {
+		return 0
+	}
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return m.GetOrganization() == "Nokia"
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
 func (s *srosDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
 	req, err := gapi.NewGetRequest(
 		gapi.Path(srosSWVersionPath),
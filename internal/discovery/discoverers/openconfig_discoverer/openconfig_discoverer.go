@@ -0,0 +1,146 @@
+package openconfig_discoverer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ocHostnamePath      = "system/state/hostname"
+	ocComponentTypePath = "components/component/state/type"
+	ocHWMacAddressPath  = "lldp/state/chassis-id"
+	// state of the chassis component, its name is only known after listing the component types
+	ocChassisStatePathFmt = "components/component[name=%s]/state"
+
+	ocChassisType = "CHASSIS"
+)
+
+func init() {
+	discoverers.Register(discoverers.OpenConfigDiscovererName, func() discoverers.Discoverer {
+		return &ocDiscoverer{}
+	})
+}
+
+type ocDiscoverer struct{}
+
+// Detect matches any target supporting the openconfig-system and openconfig-platform models
+// with a low score, so that it is only used when no vendor discoverer matches.
+func (s *ocDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	system := discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return m.GetName() == "openconfig-system"
+	})
+	platform := discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return m.GetName() == "openconfig-platform"
+	})
+	if system && platform {
+		return discoverers.FallbackScore
+	}
+	return 0
+}
+
+func (s *ocDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encoding := discoverers.JSONEncoding(capRsp)
+	di := &targetv1.DiscoveryInfo{
+		VendorType: discoverers.VendorTypeOpenConfig,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+
+	// get the hostname and the component types to find the chassis
+	req, err := gapi.NewGetRequest(
+		gapi.Path(ocHostnamePath),
+		gapi.Path(ocComponentTypePath),
+		encoding,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	chassis := setHostName(di, resp)
+	if chassis == "" {
+		return nil, errors.New("no chassis component found")
+	}
+
+	req, err = gapi.NewGetRequest(
+		gapi.Path(fmt.Sprintf(ocChassisStatePathFmt, chassis)),
+		gapi.Path(ocHWMacAddressPath),
+		encoding,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	setChassisInfo(di, resp)
+	return di, nil
+}
+
+// setHostName sets the hostname from the response to the hostname and component types request,
+// the name of the first chassis component is returned.
+func setHostName(di *targetv1.DiscoveryInfo, resp *gnmi.GetResponse) string {
+	var chassis string
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			component := discoverers.ComponentName(notif.GetPrefix(), upd.GetPath())
+			for p, val := range discoverers.Leaves(notif.GetPrefix(), upd) {
+				switch {
+				case p == ocHostnamePath:
+					di.HostName = val
+				case p == ocComponentTypePath && chassis == "" && isChassis(val):
+					chassis = component
+				}
+			}
+		}
+	}
+	return chassis
+}
+
+func setChassisInfo(di *targetv1.DiscoveryInfo, resp *gnmi.GetResponse) {
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			for p, val := range discoverers.Leaves(notif.GetPrefix(), upd) {
+				switch p {
+				case "components/component/state/serial-no":
+					di.SerialNumber = val
+				case "components/component/state/part-no":
+					di.Platform = val
+				case "components/component/state/software-version":
+					di.SwVersion = val
+				case ocHWMacAddressPath:
+					di.MacAddress = val
+				}
+			}
+		}
+	}
+}
+
+// isChassis checks the component type identity, which can be prefixed
+// by its module name, e.g openconfig-platform-types:CHASSIS
+func isChassis(t string) bool {
+	return t == ocChassisType || strings.HasSuffix(t, ":"+ocChassisType)
+}
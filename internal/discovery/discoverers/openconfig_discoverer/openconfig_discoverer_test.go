@@ -0,0 +1,120 @@
+package openconfig_discoverer
+
+import (
+	"reflect"
+	"testing"
+
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+)
+
+func notification(t *testing.T, path string, val *gnmi.TypedValue) *gnmi.Notification {
+	p, err := gutils.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gnmi.Notification{Update: []*gnmi.Update{{Path: p, Val: val}}}
+}
+
+func jsonIetfVal(s string) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(s)}}
+}
+
+func TestSetHostName(t *testing.T) {
+	tests := []struct {
+		name        string
+		notifs      func(t *testing.T) []*gnmi.Notification
+		wantHost    string
+		wantChassis string
+	}{
+		{
+			name: "module prefixed chassis type",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, ocHostnamePath, jsonIetfVal(`"spine1"`)),
+					notification(t, "components/component[name=Linecard1]/state/type", jsonIetfVal(`"openconfig-platform-types:LINECARD"`)),
+					notification(t, "components/component[name=Chassis]/state/type", jsonIetfVal(`"openconfig-platform-types:CHASSIS"`)),
+				}
+			},
+			wantHost:    "spine1",
+			wantChassis: "Chassis",
+		},
+		{
+			name: "unprefixed chassis type",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, "components/component[name=1]/state/type", jsonIetfVal(`"CHASSIS"`)),
+				}
+			},
+			wantChassis: "1",
+		},
+		{
+			name: "no chassis",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, ocHostnamePath, jsonIetfVal(`"spine1"`)),
+					notification(t, "components/component[name=Fan1]/state/type", jsonIetfVal(`"openconfig-platform-types:FAN"`)),
+				}
+			},
+			wantHost: "spine1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := &targetv1.DiscoveryInfo{}
+			chassis := setHostName(di, &gnmi.GetResponse{Notification: tt.notifs(t)})
+			if chassis != tt.wantChassis {
+				t.Errorf("got chassis %q, want %q", chassis, tt.wantChassis)
+			}
+			if di.HostName != tt.wantHost {
+				t.Errorf("got hostname %q, want %q", di.HostName, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestSetChassisInfo(t *testing.T) {
+	want := targetv1.DiscoveryInfo{
+		Platform:     "7220 IXR-D2",
+		MacAddress:   "1a:2b:3c:ff:00:00",
+		SerialNumber: "NS2021",
+		SwVersion:    "v22.3.1",
+	}
+	tests := []struct {
+		name   string
+		notifs func(t *testing.T) []*gnmi.Notification
+	}{
+		{
+			name: "JSON_IETF containers",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, "components/component[name=Chassis]/state", jsonIetfVal(
+						`{"openconfig-platform:serial-no":"NS2021","part-no":"7220 IXR-D2","software-version":"v22.3.1","type":"openconfig-platform-types:CHASSIS"}`,
+					)),
+					notification(t, "lldp/state", jsonIetfVal(`{"openconfig-lldp:chassis-id":"1a:2b:3c:ff:00:00","chassis-id-type":"MAC_ADDRESS"}`)),
+				}
+			},
+		},
+		{
+			name: "leaves",
+			notifs: func(t *testing.T) []*gnmi.Notification {
+				return []*gnmi.Notification{
+					notification(t, "components/component[name=Chassis]/state/serial-no", jsonIetfVal(`"NS2021"`)),
+					notification(t, "components/component[name=Chassis]/state/part-no", jsonIetfVal(`"7220 IXR-D2"`)),
+					notification(t, "components/component[name=Chassis]/state/software-version", jsonIetfVal(`"v22.3.1"`)),
+					notification(t, ocHWMacAddressPath, jsonIetfVal(`"1a:2b:3c:ff:00:00"`)),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := &targetv1.DiscoveryInfo{}
+			setChassisInfo(di, &gnmi.GetResponse{Notification: tt.notifs(t)})
+			if !reflect.DeepEqual(*di, want) {
+				t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+// Package profile_discoverer implements a discoverer driven by DiscovererProfile resources.
+package profile_discoverer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// New returns a discoverer getting the discovery info from the paths declared in the profile.
+func New(p *discoveryv1alphav1.DiscovererProfile) discoverers.Discoverer {
+	return &profileDiscoverer{profile: p}
+}
+
+// Lookup returns the highest priority profile matching the target capabilities,
+// nil if none matches. Profiles with the same priority are consulted by name,
+// invalid profiles are skipped. The profiles are listed once per context set up
+// with WithProfiles, otherwise on every call.
+func Lookup(ctx context.Context, c client.Client, capRsp *gnmi.CapabilityResponse, logger logging.Logger) (*discoveryv1alphav1.DiscovererProfile, error) {
+	profiles, err := listProfiles(ctx, c, logger)
+	if err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		ok, err := Matches(&profiles[i], capRsp)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &profiles[i], nil
+		}
+	}
+	return nil, nil
+}
+
+type profilesKey struct{}
+
+// profiles are the valid profiles sorted by priority, listed once
+type profiles struct {
+	once  sync.Once
+	items []discoveryv1alphav1.DiscovererProfile
+	err   error
+}
+
+// WithProfiles returns a context in which Lookup lists the profiles on its first call only,
+// a discovery rule run uses it so that the profiles are not listed for every host.
+func WithProfiles(ctx context.Context) context.Context {
+	return context.WithValue(ctx, profilesKey{}, &profiles{})
+}
+
+func listProfiles(ctx context.Context, c client.Client, logger logging.Logger) ([]discoveryv1alphav1.DiscovererProfile, error) {
+	p, ok := ctx.Value(profilesKey{}).(*profiles)
+	if !ok {
+		return validProfiles(ctx, c, logger)
+	}
+	p.once.Do(func() {
+		p.items, p.err = validProfiles(ctx, c, logger)
+	})
+	return p.items, p.err
+}
+
+// validProfiles lists the valid profiles, sorted by decreasing priority and name
+func validProfiles(ctx context.Context, c client.Client, logger logging.Logger) ([]discoveryv1alphav1.DiscovererProfile, error) {
+	pList := &discoveryv1alphav1.DiscovererProfileList{}
+	err := c.List(ctx, pList)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]discoveryv1alphav1.DiscovererProfile, 0, len(pList.Items))
+	for _, p := range pList.Items {
+		err = Validate(&p)
+		if err != nil {
+			logger.Info("skipping invalid discoverer profile", "profile", p.GetName(), "error", err)
+			continue
+		}
+		items = append(items, p)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Spec.Priority != items[j].Spec.Priority {
+			return items[i].Spec.Priority > items[j].Spec.Priority
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+	return items, nil
+}
+
+// Validate checks the model name regular expressions and the paths of the profile.
+func Validate(p *discoveryv1alphav1.DiscovererProfile) error {
+	for _, cm := range p.Spec.Match {
+		if _, err := regexp.Compile(cm.ModelName); err != nil {
+			return fmt.Errorf("invalid model name %q: %w", cm.ModelName, err)
+		}
+	}
+	for _, f := range fieldPaths(p, &targetv1.DiscoveryInfo{}) {
+		if _, err := utils.ParsePath(f.pv.Path); err != nil {
+			return fmt.Errorf("invalid path %q: %w", f.pv.Path, err)
+		}
+	}
+	return nil
+}
+
+// Matches checks if any of the profile capability match rules matches a model supported by the target.
+func Matches(p *discoveryv1alphav1.DiscovererProfile, capRsp *gnmi.CapabilityResponse) (bool, error) {
+	for _, cm := range p.Spec.Match {
+		var re *regexp.Regexp
+		if cm.ModelName != "" {
+			var err error
+			re, err = regexp.Compile(cm.ModelName)
+			if err != nil {
+				return false, err
+			}
+		}
+		for _, m := range capRsp.GetSupportedModels() {
+			if cm.Organization != "" && cm.Organization != m.GetOrganization() {
+				continue
+			}
+			if re != nil && !re.MatchString(m.GetName()) {
+				continue
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type profileDiscoverer struct {
+	profile *discoveryv1alphav1.DiscovererProfile
+}
+
+func (s *profileDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	ok, err := Matches(s.profile, capRsp)
+	if err != nil || !ok {
+		return 0
+	}
+	return discoverers.MaxScore
+}
+
+func (s *profileDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	di := &targetv1.DiscoveryInfo{
+		VendorType: targetv1.VendorType(s.profile.Spec.VendorType),
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+	fields := fieldPaths(s.profile, di)
+	if len(fields) == 0 {
+		return di, nil
+	}
+	req, paths, err := s.getRequest(fields)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	err = extractFields(fields, paths, resp)
+	if err != nil {
+		return nil, err
+	}
+	return di, nil
+}
+
+// fieldPath is a discovery info field and the path its value is read from
+type fieldPath struct {
+	pv  *discoveryv1alphav1.PathValue
+	dst *string
+}
+
+// fieldPaths returns the discovery info fields of di with a path in the profile
+func fieldPaths(p *discoveryv1alphav1.DiscovererProfile, di *targetv1.DiscoveryInfo) []fieldPath {
+	paths := p.Spec.Paths
+	fields := make([]fieldPath, 0, 5)
+	for _, f := range []fieldPath{
+		{pv: paths.HostName, dst: &di.HostName},
+		{pv: paths.Platform, dst: &di.Platform},
+		{pv: paths.MacAddress, dst: &di.MacAddress},
+		{pv: paths.SerialNumber, dst: &di.SerialNumber},
+		{pv: paths.SwVersion, dst: &di.SwVersion},
+	} {
+		if f.pv != nil {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// getRequest builds a single Get request for the paths of the fields,
+// the parsed path of each field is returned in the same order.
+func (s *profileDiscoverer) getRequest(fields []fieldPath) (*gnmi.GetRequest, []*gnmi.Path, error) {
+	encoding := s.profile.Spec.Encoding
+	if encoding == "" {
+		encoding = "JSON"
+	}
+	opts := []gapi.GNMIOption{
+		gapi.Encoding(encoding),
+		gapi.Target(s.profile.Spec.Target),
+	}
+	paths := make([]*gnmi.Path, 0, len(fields))
+	requested := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		p, err := utils.ParsePath(f.pv.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid path %q: %w", f.pv.Path, err)
+		}
+		paths = append(paths, p)
+		if _, ok := requested[f.pv.Path]; ok {
+			continue
+		}
+		requested[f.pv.Path] = struct{}{}
+		opts = append(opts, gapi.Path(f.pv.Path))
+	}
+	req, err := gapi.NewGetRequest(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, paths, nil
+}
+
+// extractFields sets each field to the value of the first update under its path in the Get response.
+// Fields without update are left empty.
+func extractFields(fields []fieldPath, paths []*gnmi.Path, resp *gnmi.GetResponse) error {
+	found := make([]bool, len(fields))
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			elems := make([]*gnmi.PathElem, 0, len(notif.GetPrefix().GetElem())+len(upd.GetPath().GetElem()))
+			elems = append(elems, notif.GetPrefix().GetElem()...)
+			elems = append(elems, upd.GetPath().GetElem()...)
+			for i, f := range fields {
+				if found[i] || !hasPathPrefix(elems, paths[i].GetElem()) {
+					continue
+				}
+				v, err := Extract(f.pv, upd.GetVal())
+				if err != nil {
+					return fmt.Errorf("failed to get %q: %w", f.pv.Path, err)
+				}
+				*f.dst = v
+				found[i] = true
+			}
+		}
+	}
+	return nil
+}
+
+// hasPathPrefix checks if the prefix elements match the first elements of the path.
+// Module prefixes of the element names are ignored, as targets return them inconsistently,
+// and a '*' key value in the prefix matches any value.
+func hasPathPrefix(elems, prefix []*gnmi.PathElem) bool {
+	if len(prefix) > len(elems) {
+		return false
+	}
+	for i, pe := range prefix {
+		if elemName(pe.GetName()) != elemName(elems[i].GetName()) {
+			return false
+		}
+		for k, v := range pe.GetKey() {
+			if v != "*" && elems[i].GetKey()[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func elemName(name string) string {
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Extract returns the value of tv as a string following the value type and selector of pv.
+func Extract(pv *discoveryv1alphav1.PathValue, tv *gnmi.TypedValue) (string, error) {
+	if pv.Value != discoveryv1alphav1.ValueTypeJSON {
+		return discoverers.StringValue(tv), nil
+	}
+	var b []byte
+	switch v := tv.GetValue().(type) {
+	case *gnmi.TypedValue_JsonVal:
+		b = v.JsonVal
+	case *gnmi.TypedValue_JsonIetfVal:
+		b = v.JsonIetfVal
+	default:
+		return "", fmt.Errorf("unexpected value type %T, expecting a JSON value", v)
+	}
+	var val interface{}
+	err := json.Unmarshal(b, &val)
+	if err != nil {
+		return "", err
+	}
+	val, err = Select(val, pv.Selector)
+	if err != nil {
+		return "", err
+	}
+	switch val := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(val)
+		return string(b), err
+	default:
+		return fmt.Sprint(val), nil
+	}
+}
@@ -0,0 +1,304 @@
+package profile_discoverer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMatches(t *testing.T) {
+	capRsp := &gnmi.CapabilityResponse{
+		SupportedModels: []*gnmi.ModelData{
+			{Name: "openconfig-system", Organization: "OpenConfig working group"},
+			{Name: "arista-exp-eos", Organization: "Arista Networks <http://arista.com/>"},
+		},
+	}
+	tests := []struct {
+		name    string
+		match   []discoveryv1alphav1.CapabilityMatch
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:  "organization",
+			match: []discoveryv1alphav1.CapabilityMatch{{Organization: "Arista Networks <http://arista.com/>"}},
+			want:  true,
+		},
+		{
+			name:  "model name regex",
+			match: []discoveryv1alphav1.CapabilityMatch{{ModelName: "^arista-"}},
+			want:  true,
+		},
+		{
+			name: "organization and model name must match the same model",
+			match: []discoveryv1alphav1.CapabilityMatch{{
+				Organization: "OpenConfig working group",
+				ModelName:    "^arista-",
+			}},
+			want: false,
+		},
+		{
+			name:  "any rule",
+			match: []discoveryv1alphav1.CapabilityMatch{{ModelName: "^junos-"}, {ModelName: "eos$"}},
+			want:  true,
+		},
+		{
+			name:    "invalid regex",
+			match:   []discoveryv1alphav1.CapabilityMatch{{ModelName: "("}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &discoveryv1alphav1.DiscovererProfile{
+				Spec: discoveryv1alphav1.DiscovererProfileSpec{Match: tt.match},
+			}
+			got, err := Matches(p, capRsp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	jsonIetf := &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(
+		`{"openconfig-platform:state":{"serial-no":"SN1","part-no":"DCS-7050"},"subcomponents":{"subcomponent":[{"name":"a"},{"name":"b"}]},"mtu":9000}`,
+	)}}
+	tests := []struct {
+		name    string
+		pv      discoveryv1alphav1.PathValue
+		val     *gnmi.TypedValue
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "string_val",
+			pv:   discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeStringVal},
+			val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "r1"}},
+			want: "r1",
+		},
+		{
+			name: "module prefixed member",
+			pv:   discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeJSON, Selector: ".state.serial-no"},
+			val:  jsonIetf,
+			want: "SN1",
+		},
+		{
+			name: "list index",
+			pv:   discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeJSON, Selector: ".subcomponents.subcomponent[1].name"},
+			val:  jsonIetf,
+			want: "b",
+		},
+		{
+			name: "number",
+			pv:   discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeJSON, Selector: ".mtu"},
+			val:  jsonIetf,
+			want: "9000",
+		},
+		{
+			name: "missing member",
+			pv:   discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeJSON, Selector: ".state.description"},
+			val:  jsonIetf,
+			want: "",
+		},
+		{
+			name:    "invalid selector",
+			pv:      discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeJSON, Selector: ".a[x]"},
+			val:     jsonIetf,
+			wantErr: true,
+		},
+		{
+			name:    "not a JSON value",
+			pv:      discoveryv1alphav1.PathValue{Value: discoveryv1alphav1.ValueTypeJSON},
+			val:     &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "r1"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(&tt.pv, tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := discoveryv1alphav1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	profile := func(name string, priority int, modelName string) *discoveryv1alphav1.DiscovererProfile {
+		return &discoveryv1alphav1.DiscovererProfile{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: discoveryv1alphav1.DiscovererProfileSpec{
+				Priority: priority,
+				Match:    []discoveryv1alphav1.CapabilityMatch{{ModelName: modelName}},
+			},
+		}
+	}
+	invalidPath := profile("invalid-path", 10, "^arista-")
+	invalidPath.Spec.Paths.SerialNumber = &discoveryv1alphav1.PathValue{Path: "/components/component[name=chassis"}
+	c := &listCounter{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		profile("invalid", 10, "("),
+		invalidPath,
+		profile("eos", 5, "^arista-"),
+		profile("srl", 5, "^srl_nokia-"),
+	).Build()}
+	capRsp := &gnmi.CapabilityResponse{
+		SupportedModels: []*gnmi.ModelData{{Name: "arista-exp-eos"}},
+	}
+	p, err := Lookup(context.Background(), c, capRsp, logging.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || p.GetName() != "eos" {
+		t.Errorf("got profile %v, want eos", p)
+	}
+
+	// the profiles are listed once per run
+	c.lists = 0
+	ctx := WithProfiles(context.Background())
+	for _, model := range []string{"arista-exp-eos", "srl_nokia-system", "openconfig-system"} {
+		_, err = Lookup(ctx, c, &gnmi.CapabilityResponse{SupportedModels: []*gnmi.ModelData{{Name: model}}}, logging.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.lists != 1 {
+		t.Errorf("got %d profile lists, want 1", c.lists)
+	}
+}
+
+// listCounter counts the List requests
+type listCounter struct {
+	client.Client
+	lists int
+}
+
+func (c *listCounter) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	c.lists++
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    discoveryv1alphav1.DiscovererProfileSpec
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			spec: discoveryv1alphav1.DiscovererProfileSpec{
+				Match: []discoveryv1alphav1.CapabilityMatch{{ModelName: "^arista-"}, {Organization: "OpenConfig working group"}},
+				Paths: discoveryv1alphav1.DiscoveryInfoPaths{
+					HostName: &discoveryv1alphav1.PathValue{Path: "openconfig:/system/state/hostname"},
+				},
+			},
+		},
+		{
+			name: "invalid model name",
+			spec: discoveryv1alphav1.DiscovererProfileSpec{
+				Match: []discoveryv1alphav1.CapabilityMatch{{ModelName: "("}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid path",
+			spec: discoveryv1alphav1.DiscovererProfileSpec{
+				Match: []discoveryv1alphav1.CapabilityMatch{{ModelName: "^arista-"}},
+				Paths: discoveryv1alphav1.DiscoveryInfoPaths{
+					SerialNumber: &discoveryv1alphav1.PathValue{Path: "/components/component[name=chassis"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		err := Validate(&discoveryv1alphav1.DiscovererProfile{Spec: tt.spec})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestGetRequestAndExtractFields(t *testing.T) {
+	s := &profileDiscoverer{profile: &discoveryv1alphav1.DiscovererProfile{
+		Spec: discoveryv1alphav1.DiscovererProfileSpec{
+			Paths: discoveryv1alphav1.DiscoveryInfoPaths{
+				HostName: &discoveryv1alphav1.PathValue{Path: "/system/state/hostname"},
+				Platform: &discoveryv1alphav1.PathValue{
+					Path:     "/components/component[name=Chassis]/state",
+					Value:    discoveryv1alphav1.ValueTypeJSON,
+					Selector: ".part-no",
+				},
+				SerialNumber: &discoveryv1alphav1.PathValue{
+					Path:     "/components/component[name=Chassis]/state",
+					Value:    discoveryv1alphav1.ValueTypeJSON,
+					Selector: ".serial-no",
+				},
+				SwVersion: &discoveryv1alphav1.PathValue{Path: "/system/state/software-version"},
+			},
+		},
+	}}
+	di := &targetv1.DiscoveryInfo{}
+	fields := fieldPaths(s.profile, di)
+	req, paths, err := s.getRequest(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the chassis state is requested once for both fields
+	if len(req.GetPath()) != 3 || len(paths) != 4 {
+		t.Fatalf("got %d request paths and %d field paths, want 3 and 4", len(req.GetPath()), len(paths))
+	}
+	if req.GetEncoding() != gnmi.Encoding_JSON {
+		t.Errorf("got encoding %s, want the JSON default", req.GetEncoding())
+	}
+
+	elem := func(name string, keys map[string]string) *gnmi.PathElem {
+		return &gnmi.PathElem{Name: name, Key: keys}
+	}
+	resp := &gnmi.GetResponse{
+		Notification: []*gnmi.Notification{
+			{
+				// chassis state returned before the hostname, with a module prefixed name
+				Prefix: &gnmi.Path{Elem: []*gnmi.PathElem{elem("openconfig-platform:components", nil)}},
+				Update: []*gnmi.Update{{
+					Path: &gnmi.Path{Elem: []*gnmi.PathElem{elem("component", map[string]string{"name": "Chassis"}), elem("state", nil)}},
+					Val: &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonVal{
+						JsonVal: []byte(`{"part-no":"DCS-7050SX3","serial-no":"SN1"}`),
+					}},
+				}},
+			},
+			{
+				Update: []*gnmi.Update{{
+					Path: &gnmi.Path{Elem: []*gnmi.PathElem{elem("system", nil), elem("state", nil), elem("hostname", nil)}},
+					Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "leaf1"}},
+				}},
+			},
+		},
+	}
+	if err := extractFields(fields, paths, resp); err != nil {
+		t.Fatal(err)
+	}
+	want := targetv1.DiscoveryInfo{HostName: "leaf1", Platform: "DCS-7050SX3", SerialNumber: "SN1"}
+	if di.HostName != want.HostName || di.Platform != want.Platform || di.SerialNumber != want.SerialNumber || di.SwVersion != "" {
+		t.Errorf("got discovery info %+v, want %+v", di, want)
+	}
+}
@@ -0,0 +1,85 @@
+package profile_discoverer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Select applies a jq-like selector to a decoded JSON value.
+// The selector is a list of member names and list indexes, e.g. .a.b[0].c
+// Member names match JSON_IETF members prefixed by their module name.
+func Select(v interface{}, selector string) (interface{}, error) {
+	if selector == "" || selector == "." {
+		return v, nil
+	}
+	if !strings.HasPrefix(selector, ".") {
+		return nil, fmt.Errorf("invalid selector %q: must start with '.'", selector)
+	}
+	for _, seg := range strings.Split(selector[1:], ".") {
+		name := seg
+		var indexes []string
+		if i := strings.Index(seg, "["); i >= 0 {
+			name = seg[:i]
+			idx, err := parseIndexes(seg[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+			}
+			indexes = idx
+		}
+		if name != "" {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			v = member(m, name)
+		}
+		for _, idx := range indexes {
+			l, ok := v.([]interface{})
+			if !ok {
+				return nil, nil
+			}
+			i, _ := strconv.Atoi(idx)
+			if i >= len(l) {
+				return nil, nil
+			}
+			v = l[i]
+		}
+	}
+	return v, nil
+}
+
+// member returns the value of the member name,
+// falling back to a member prefixed by a module name
+func member(m map[string]interface{}, name string) interface{} {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	for k, v := range m {
+		if i := strings.Index(k, ":"); i >= 0 && k[i+1:] == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// parseIndexes parses a list of indexes such as [0][1]
+func parseIndexes(s string) ([]string, error) {
+	var indexes []string
+	for s != "" {
+		if !strings.HasPrefix(s, "[") {
+			return nil, fmt.Errorf("unexpected %q", s)
+		}
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("missing ']' in %q", s)
+		}
+		idx := s[1:end]
+		if i, err := strconv.Atoi(idx); err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid index %q", idx)
+		}
+		indexes = append(indexes, idx)
+		s = s[end+1:]
+	}
+	return indexes, nil
+}
@@ -0,0 +1,131 @@
+package sonic_discoverer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gapi "github.com/karimra/gnmic/api"
+	"github.com/karimra/gnmic/target"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	discoveryv1alphav1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SONiC telemetry exposes the redis databases and virtual paths
+// using the database name as target of the request prefix
+const (
+	sonicConfigDB = "CONFIG_DB"
+	sonicStateDB  = "STATE_DB"
+	sonicOthers   = "OTHERS"
+
+	sonicDeviceMetadataPath = "DEVICE_METADATA/localhost"
+	// ONIE TLV 0x23 is the serial number
+	sonicSerialNumberPath = "EEPROM_INFO/0x23"
+	sonicSWVersionPath    = "osversion/build"
+)
+
+func init() {
+	discoverers.Register(discoverers.SONiCDiscovererName, func() discoverers.Discoverer {
+		return &sonicDiscoverer{}
+	})
+}
+
+type sonicDiscoverer struct{}
+
+// Detect matches the SONiC YANG models (sonic-port, sonic-device_metadata, ...)
+// or the sonic-db origin advertised as a model by the telemetry server
+func (s *sonicDiscoverer) Detect(capRsp *gnmi.CapabilityResponse) int {
+	if discoverers.HasModel(capRsp, func(m *gnmi.ModelData) bool {
+		return m.GetOrganization() == "SONiC" || strings.HasPrefix(m.GetName(), "sonic-")
+	}) {
+		return discoverers.MaxScore
+	}
+	return 0
+}
+
+func (s *sonicDiscoverer) Discover(ctx context.Context, dr *discoveryv1alphav1.DiscoveryRule, t *target.Target) (*targetv1.DiscoveryInfo, error) {
+	capRsp, err := t.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encoding := discoverers.JSONEncoding(capRsp)
+	di := &targetv1.DiscoveryInfo{
+		VendorType: discoverers.VendorTypeSONiC,
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+		SupportedEncodings: make([]string, 0, len(capRsp.GetSupportedEncodings())),
+	}
+	for _, enc := range capRsp.GetSupportedEncodings() {
+		di.SupportedEncodings = append(di.SupportedEncodings, enc.String())
+	}
+
+	leaves, err := getLeaves(ctx, t, sonicConfigDB, sonicDeviceMetadataPath, encoding)
+	if err != nil {
+		return nil, err
+	}
+	setDeviceMetadata(di, leaves)
+
+	// the EEPROM and version info are not available on all platforms (e.g virtual switches)
+	leaves, err = getLeaves(ctx, t, sonicStateDB, sonicSerialNumberPath, encoding)
+	if err == nil {
+		di.SerialNumber = leaves[sonicSerialNumberPath+"/Value"]
+	}
+	leaves, err = getLeaves(ctx, t, sonicOthers, sonicSWVersionPath, encoding)
+	if err == nil {
+		setSWVersion(di, leaves)
+	}
+	return di, nil
+}
+
+func setDeviceMetadata(di *targetv1.DiscoveryInfo, leaves map[string]string) {
+	di.HostName = leaves[sonicDeviceMetadataPath+"/hostname"]
+	di.MacAddress = leaves[sonicDeviceMetadataPath+"/mac"]
+	// the hwsku identifies the switch model, the platform its ONIE platform string
+	di.Platform = leaves[sonicDeviceMetadataPath+"/hwsku"]
+	if di.Platform == "" {
+		di.Platform = leaves[sonicDeviceMetadataPath+"/platform"]
+	}
+}
+
+// setSWVersion sets the software version from the build version string,
+// or from the build_version member of the version info
+func setSWVersion(di *targetv1.DiscoveryInfo, leaves map[string]string) {
+	di.SwVersion = leaves[sonicSWVersionPath]
+	if di.SwVersion == "" {
+		di.SwVersion = leaves[sonicSWVersionPath+"/build_version"]
+	}
+}
+
+// getLeaves gets path from the given SONiC database and returns its leaves
+func getLeaves(ctx context.Context, t *target.Target, db, path string, encoding gapi.GNMIOption) (map[string]string, error) {
+	req, err := gapi.NewGetRequest(
+		gapi.Target(db),
+		gapi.Path(path),
+		encoding,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return responseLeaves(resp), nil
+}
+
+// responseLeaves returns the leaves of all the updates of a Get response
+func responseLeaves(resp *gnmi.GetResponse) map[string]string {
+	leaves := make(map[string]string)
+	for _, notif := range resp.GetNotification() {
+		for _, upd := range notif.GetUpdate() {
+			for p, val := range discoverers.Leaves(notif.GetPrefix(), upd) {
+				leaves[p] = val
+			}
+		}
+	}
+	return leaves
+}
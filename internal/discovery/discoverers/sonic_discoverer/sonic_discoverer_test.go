@@ -0,0 +1,79 @@
+package sonic_discoverer
+
+import (
+	"reflect"
+	"testing"
+
+	gutils "github.com/karimra/gnmic/utils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+)
+
+func response(t *testing.T, db, path, val string) *gnmi.GetResponse {
+	p, err := gutils.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gnmi.GetResponse{Notification: []*gnmi.Notification{{
+		Prefix: &gnmi.Path{Target: db},
+		Update: []*gnmi.Update{{
+			Path: p,
+			Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}},
+		}},
+	}}}
+}
+
+func TestSetDeviceMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		want targetv1.DiscoveryInfo
+	}{
+		{
+			name: "hwsku",
+			val:  `{"hostname":"leaf1","hwsku":"Accton-AS7726-32X","mac":"0c:29:ef:a1:b2:c3","platform":"x86_64-accton_as7726_32x-r0"}`,
+			want: targetv1.DiscoveryInfo{HostName: "leaf1", Platform: "Accton-AS7726-32X", MacAddress: "0c:29:ef:a1:b2:c3"},
+		},
+		{
+			name: "platform without hwsku",
+			val:  `{"hostname":"vs1","mac":"52:54:00:12:34:56","platform":"x86_64-kvm_x86_64-r0"}`,
+			want: targetv1.DiscoveryInfo{HostName: "vs1", Platform: "x86_64-kvm_x86_64-r0", MacAddress: "52:54:00:12:34:56"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := &targetv1.DiscoveryInfo{}
+			setDeviceMetadata(di, responseLeaves(response(t, sonicConfigDB, sonicDeviceMetadataPath, tt.val)))
+			if !reflect.DeepEqual(*di, tt.want) {
+				t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSWVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		want string
+	}{
+		{name: "build string", val: `"SONiC.202012.123-abcdef"`, want: "SONiC.202012.123-abcdef"},
+		{name: "version info", val: `{"build_version":"SONiC.202205.1","debian_version":"11.3","kernel_version":"5.10.0"}`, want: "SONiC.202205.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := &targetv1.DiscoveryInfo{}
+			setSWVersion(di, responseLeaves(response(t, sonicOthers, sonicSWVersionPath, tt.val)))
+			if di.SwVersion != tt.want {
+				t.Errorf("got software version %q, want %q", di.SwVersion, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialNumber(t *testing.T) {
+	leaves := responseLeaves(response(t, sonicStateDB, sonicSerialNumberPath, `{"Len":"12","Name":"Serial Number","Value":"ABC123456789"}`))
+	if got := leaves[sonicSerialNumberPath+"/Value"]; got != "ABC123456789" {
+		t.Errorf("got serial number %q, want ABC123456789", got)
+	}
+}
@@ -0,0 +1,16 @@
+package discoverers
+
+import targetv1 "github.com/yndd/target/apis/target/v1"
+
+// vendor types of the targets discovered for vendors
+// not defined by the target API, the targets are applied
+// with the unknown vendor type if the target CRD rejects them
+const (
+	VendorTypeAristaEOS    targetv1.VendorType = "aristaEOS"
+	VendorTypeJuniperJunos targetv1.VendorType = "juniperJunos"
+	VendorTypeCiscoIOSXR   targetv1.VendorType = "ciscoIOSXR"
+	VendorTypeCiscoNXOS    targetv1.VendorType = "ciscoNXOS"
+	VendorTypeSONiC        targetv1.VendorType = "sonic"
+	// OpenConfig compliant target of an unknown vendor
+	VendorTypeOpenConfig targetv1.VendorType = "openconfig"
+)
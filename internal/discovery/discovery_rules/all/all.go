@@ -1,6 +1,9 @@
 package all
 
 import (
+	_ "github.com/yndd/discovery/internal/discovery/discovery_rules/api_rule"
+	_ "github.com/yndd/discovery/internal/discovery/discovery_rules/consul"
 	_ "github.com/yndd/discovery/internal/discovery/discovery_rules/ip_range"
+	_ "github.com/yndd/discovery/internal/discovery/discovery_rules/netbox"
 	_ "github.com/yndd/discovery/internal/discovery/discovery_rules/topology_watch"
 )
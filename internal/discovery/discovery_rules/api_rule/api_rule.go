@@ -0,0 +1,208 @@
+package api_rule
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"golang.org/x/sync/semaphore"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultMethod      = http.MethodGet
+	defaultHTTPTimeout = 30 * time.Second
+	// number of addresses discovered concurrently
+	defaultConcurrentScanNumber = 10
+)
+
+func init() {
+	discoveryrules.Register(discoveryrules.APIDiscoveryRule, func() discoveryrules.DiscoveryRule {
+		return &apiDR{}
+	})
+}
+
+type apiDR struct {
+	client  client.Client
+	logger  logging.Logger
+	cfn     context.CancelFunc
+	trigger <-chan string
+
+	// discovers a host, discoveryrules.Discover unless set by tests
+	discover discoverFunc
+}
+
+type discoverFunc func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error
+
+func (a *apiDR) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, opts ...discoveryrules.Option) error {
+	ctx, a.cfn = context.WithCancel(ctx)
+	for _, o := range opts {
+		o(a)
+	}
+	if a.discover == nil {
+		a.discover = discoveryrules.Discover
+	}
+	a.logger = a.logger.WithValues("discovery-rule", fmt.Sprintf("%s/%s", dr.GetNamespace(), dr.GetName()))
+	return discoveryrules.RunPeriodically(ctx, a.client, dr, a.logger, a.trigger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+		return a.run(ctx, dr, stats)
+	})
+}
+
+func (a *apiDR) Stop() error {
+	a.cfn()
+	return nil
+}
+
+func (a *apiDR) SetLogger(logger logging.Logger) {
+	a.logger = logger
+}
+
+func (a *apiDR) SetClient(c client.Client) {
+	a.client = c
+}
+
+func (a *apiDR) SetTrigger(trigger <-chan string) {
+	a.trigger = trigger
+}
+
+func (a *apiDR) run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, stats *discoveryrules.RunStats) error {
+	body, err := query(ctx, dr.Spec.APIRule)
+	if err != nil {
+		return err
+	}
+	addrs, err := renderAddresses(dr.Spec.APIRule.ResponseTemplate, body)
+	if err != nil {
+		return err
+	}
+	a.logger.Debug("api returned addresses", "count", len(addrs))
+	var pc *discoveryrules.PreChecker
+	if dr.Spec.APIRule.CheckReachability {
+		pc = discoveryrules.NewPreChecker(dr, &discoveryv1alpha1.PreCheck{}, a.logger)
+	}
+	sem := semaphore.NewWeighted(defaultConcurrentScanNumber)
+	wg := new(sync.WaitGroup)
+	for _, ip := range addrs {
+		// fails once the run is stopped or its deadline expires
+		err = sem.Acquire(ctx, 1)
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			if pc != nil && !pc.Reachable(ctx, ip) {
+				a.logger.Debug("address not reachable", "IP", ip)
+				stats.HostScanned()
+				stats.HostUnreachable()
+				return
+			}
+			err := a.discover(ctx, a.client, dr, ip, nil, stats, a.logger)
+			if err != nil {
+				a.logger.Info("Failed discovery", "IP", ip, "error", err)
+			}
+		}(ip)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return fmt.Errorf("discovery rule run aborted: %w", ctx.Err())
+	}
+	return nil
+}
+
+// query sends the request described by the API rule and
+// returns the decoded JSON response body.
+func query(ctx context.Context, r *discoveryv1alpha1.APIRule) (interface{}, error) {
+	method := r.Method
+	if method == "" {
+		method = defaultMethod
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.OAuth != "" {
+		req.Header.Set("Authorization", "Bearer "+r.OAuth)
+	}
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+	httpClient := &http.Client{
+		Timeout: defaultHTTPTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: r.APIInsecure,
+			},
+		},
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return nil, fmt.Errorf("api request failed: %s: %s", rsp.Status, string(b))
+	}
+	var body interface{}
+	err = json.Unmarshal(b, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode api response: %w", err)
+	}
+	return body, nil
+}
+
+// renderAddresses executes the response template against the API response body.
+// The rendered output is a list of IP addresses separated by whitespace or commas,
+// addresses in prefix notation are accepted and reduced to their IP address.
+func renderAddresses(tpl string, body interface{}) ([]string, error) {
+	t, err := template.New("responseTemplate").Parse(tpl)
+	if err != nil {
+		return nil, err
+	}
+	b := new(bytes.Buffer)
+	err = t.Execute(b, body)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.FieldsFunc(b.String(), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t' || r == '\r'
+	})
+	addrs := make([]string, 0, len(fields))
+	seen := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		if strings.Contains(f, "/") {
+			ip, _, err := net.ParseCIDR(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q in api response: %w", f, err)
+			}
+			f = ip.String()
+		}
+		if net.ParseIP(f) == nil {
+			return nil, fmt.Errorf("invalid address %q in api response", f)
+		}
+		if _, ok := seen[f]; ok {
+			continue
+		}
+		seen[f] = struct{}{}
+		addrs = append(addrs, f)
+	}
+	return addrs, nil
+}
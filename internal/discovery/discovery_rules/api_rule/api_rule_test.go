@@ -0,0 +1,167 @@
+package api_rule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/devices":
+			if r.Method != http.MethodPost {
+				t.Errorf("got method %s, want POST", r.Method)
+			}
+			if got := r.Header.Get("Authorization"); got != "Bearer secret-token" {
+				t.Errorf("got authorization %q", got)
+			}
+			if got := r.Header.Get("X-Site"); got != "dc1" {
+				t.Errorf("got X-Site header %q, want dc1", got)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"devices":[{"name":"leaf1","ip":"10.0.0.1"}]}`))
+		case "/invalid":
+			w.Write([]byte(`not json`))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	body, err := query(context.Background(), &discoveryv1alpha1.APIRule{
+		URL:     srv.URL + "/devices",
+		Method:  "post",
+		OAuth:   "secret-token",
+		Headers: map[string]string{"X-Site": "dc1"},
+	})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"devices": []interface{}{map[string]interface{}{"name": "leaf1", "ip": "10.0.0.1"}},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("got body %v, want %v", body, want)
+	}
+	if _, err := query(context.Background(), &discoveryv1alpha1.APIRule{URL: srv.URL + "/missing"}); err == nil {
+		t.Error("expected an error on a not found response")
+	}
+	if _, err := query(context.Background(), &discoveryv1alpha1.APIRule{URL: srv.URL + "/invalid"}); err == nil {
+		t.Error("expected an error on a response that is not JSON")
+	}
+}
+
+func TestRenderAddresses(t *testing.T) {
+	body := map[string]interface{}{
+		"devices": []interface{}{
+			map[string]interface{}{"name": "leaf1", "ip": "10.0.0.1/24"},
+			map[string]interface{}{"name": "leaf2", "ip": "2001:db8::2"},
+			map[string]interface{}{"name": "leaf1-dup", "ip": "10.0.0.1"},
+		},
+	}
+	tests := []struct {
+		name    string
+		tpl     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "one address per line",
+			tpl:  "{{ range .devices }}{{ .ip }}\n{{ end }}",
+			want: []string{"10.0.0.1", "2001:db8::2"},
+		},
+		{
+			name: "comma separated",
+			tpl:  "{{ range $i, $d := .devices }}{{ if $i }},{{ end }}{{ $d.ip }}{{ end }}",
+			want: []string{"10.0.0.1", "2001:db8::2"},
+		},
+		{
+			name: "empty",
+			tpl:  "{{ range .missing }}{{ .ip }}{{ end }}",
+			want: []string{},
+		},
+		{
+			name:    "not an address",
+			tpl:     "{{ range .devices }}{{ .name }} {{ end }}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			tpl:     "{{ range .devices }",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderAddresses(tt.tpl, body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got addresses %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunConcurrentScans(t *testing.T) {
+	ips := make([]string, 3*defaultConcurrentScanNumber)
+	for i := range ips {
+		ips[i] = fmt.Sprintf(`"10.0.0.%d"`, i+1)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ips":[` + strings.Join(ips, ",") + `]}`))
+	}))
+	defer srv.Close()
+
+	m := new(sync.Mutex)
+	var inFlight, maxInFlight int
+	discovered := make(map[string]struct{})
+	a := &apiDR{
+		logger: logging.NewNopLogger(),
+		discover: func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error {
+			m.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			discovered[ip] = struct{}{}
+			m.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			m.Lock()
+			inFlight--
+			m.Unlock()
+			return nil
+		},
+	}
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			APIRule: &discoveryv1alpha1.APIRule{
+				URL:              srv.URL,
+				ResponseTemplate: `{{range .ips}}{{.}} {{end}}`,
+			},
+		},
+	}
+	if err := a.run(context.Background(), dr, discoveryrules.NewRunStats()); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if len(discovered) != len(ips) {
+		t.Errorf("discovered %d addresses, want %d", len(discovered), len(ips))
+	}
+	if maxInFlight > defaultConcurrentScanNumber {
+		t.Errorf("%d concurrent discoveries, want at most %d", maxInFlight, defaultConcurrentScanNumber)
+	}
+
+}
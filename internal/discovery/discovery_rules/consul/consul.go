@@ -0,0 +1,363 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	tokenSecretKey = "token"
+
+	// max time a blocking query waits for a catalog change
+	blockingQueryWaitTime = 5 * time.Minute
+
+	LabelKeyConsulNode      = "consul.yndd.io/node"
+	LabelKeyConsulServiceID = "consul.yndd.io/service-id"
+)
+
+// wait time before retrying a failed start or catalog query, shortened in tests
+var retryInterval = 10 * time.Second
+
+func init() {
+	discoveryrules.Register(discoveryrules.ConsulDiscoveryRule, func() discoveryrules.DiscoveryRule {
+		return &consulDR{}
+	})
+}
+
+type consulDR struct {
+	client client.Client
+	logger logging.Logger
+	cfn    context.CancelFunc
+	// run now requests
+	trigger <-chan string
+
+	// service instances known from the last catalog query,
+	// indexed by node and service ID
+	instances map[string]*api.CatalogService
+	// discovers a service instance, replaced in tests
+	discover discoverFunc
+}
+
+type discoverFunc func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error
+
+func (c *consulDR) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, opts ...discoveryrules.Option) error {
+	ctx, c.cfn = context.WithCancel(ctx)
+	for _, o := range opts {
+		o(c)
+	}
+	c.logger = c.logger.WithValues("discovery-rule", fmt.Sprintf("%s/%s", dr.GetNamespace(), dr.GetName()))
+	c.instances = make(map[string]*api.CatalogService)
+	if c.discover == nil {
+		c.discover = discoveryrules.Discover
+	}
+	consulClient, err := c.start(ctx, dr)
+	if err != nil {
+		return err
+	}
+	var waitIndex uint64
+	// run now request handled by the next sync
+	var runNow string
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		q := &api.QueryOptions{
+			Datacenter: dr.Spec.ConsulRule.Datacenter,
+			WaitIndex:  waitIndex,
+			WaitTime:   blockingQueryWaitTime,
+		}
+		services, meta, trigger, err := c.query(ctx, consulClient, dr, q)
+		if trigger != "" {
+			c.logger.Info("run now requested", "trigger", trigger)
+			runNow = trigger
+			// the query is restarted without blocking to sync the current instances
+			waitIndex = 0
+			continue
+		}
+		if err != nil {
+			c.logger.Info("failed catalog query", "service", dr.Spec.ConsulRule.Service, "error", err)
+			// reset the index and retry later
+			waitIndex = 0
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		// the index can go backwards (e.g after a consul server restore),
+		// in which case the blocking query is restarted from scratch
+		if meta.LastIndex < waitIndex {
+			waitIndex = 0
+			continue
+		}
+		// a blocking query timing out without changes is only reported
+		// when the sync retries failed discoveries
+		unchanged := meta.LastIndex == waitIndex
+		waitIndex = meta.LastIndex
+		// a run now request rediscovers all the instances
+		rediscover := runNow != ""
+		if unchanged && !rediscover && !c.pending(services) {
+			continue
+		}
+		if rediscover {
+			err = discoveryrules.SetRunNowHandled(ctx, c.client, dr, runNow)
+			if err != nil {
+				c.logger.Info("failed to update discovery rule status", "error", err)
+			}
+			runNow = ""
+		}
+		discoveryrules.RunAndReport(ctx, c.client, dr, c.logger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+			c.sync(ctx, dr, services, rediscover, stats)
+			return nil
+		})
+	}
+}
+
+// start loads the known service instances and creates the consul client,
+// retrying until it succeeds or ctx is done.
+func (c *consulDR) start(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) (*api.Client, error) {
+	for {
+		err := c.loadInstances(ctx, dr)
+		if err != nil {
+			c.logger.Info("failed to list the discovery rule targets", "error", err)
+		} else {
+			consulClient, err := c.newConsulClient(ctx, dr)
+			if err == nil {
+				return consulClient, nil
+			}
+			c.logger.Info("failed to create consul client", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// query runs the catalog query of the discovery rule service,
+// a blocking query is interrupted by a run now request, which is returned.
+func (c *consulDR) query(ctx context.Context, consulClient *api.Client, dr *discoveryv1alpha1.DiscoveryRule, q *api.QueryOptions) ([]*api.CatalogService, *api.QueryMeta, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		services []*api.CatalogService
+		meta     *api.QueryMeta
+		err      error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		services, meta, err := consulClient.Catalog().ServiceMultipleTags(dr.Spec.ConsulRule.Service, dr.Spec.ConsulRule.Tags, q.WithContext(ctx))
+		ch <- result{services: services, meta: meta, err: err}
+	}()
+	select {
+	case r := <-ch:
+		return r.services, r.meta, "", r.err
+	case runNow := <-c.trigger:
+		return nil, nil, runNow, nil
+	}
+}
+
+func (c *consulDR) Stop() error {
+	c.cfn()
+	return nil
+}
+
+func (c *consulDR) SetLogger(logger logging.Logger) {
+	c.logger = logger
+}
+
+func (c *consulDR) SetClient(cl client.Client) {
+	c.client = cl
+}
+
+func (c *consulDR) SetTrigger(trigger <-chan string) {
+	c.trigger = trigger
+}
+
+func (c *consulDR) newConsulClient(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) (*api.Client, error) {
+	cfg := api.DefaultConfig()
+	if dr.Spec.ConsulRule.Address != "" {
+		cfg.Address = dr.Spec.ConsulRule.Address
+	}
+	cfg.Datacenter = dr.Spec.ConsulRule.Datacenter
+	cfg.TLSConfig.InsecureSkipVerify = dr.Spec.ConsulRule.Insecure
+	if dr.Spec.ConsulRule.TokenSecret != "" {
+		secret := &corev1.Secret{}
+		err := c.client.Get(ctx, types.NamespacedName{
+			Namespace: dr.GetNamespace(),
+			Name:      dr.Spec.ConsulRule.TokenSecret,
+		}, secret)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Token = string(secret.Data[tokenSecretKey])
+	}
+	return api.NewClient(cfg)
+}
+
+// sync compares the service instances returned by the catalog with the known ones,
+// discovers the new or changed instances, all of them with rediscover,
+// and deletes the targets of the deregistered ones.
+func (c *consulDR) sync(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, services []*api.CatalogService, rediscover bool, stats *discoveryrules.RunStats) {
+	current := make(map[string]*api.CatalogService, len(services))
+	for _, s := range services {
+		current[instanceKey(s)] = s
+	}
+	for k, old := range c.instances {
+		s, ok := current[k]
+		if ok && instanceAddress(s) == instanceAddress(old) {
+			continue
+		}
+		c.logger.Info("service instance deregistered", "node", old.Node, "service-id", old.ServiceID)
+		c.deleteTargets(ctx, dr, old, stats)
+		delete(c.instances, k)
+	}
+	for k, s := range current {
+		if _, ok := c.instances[k]; ok && !rediscover {
+			continue
+		}
+		c.logger.Info("service instance registered", "node", s.Node, "service-id", s.ServiceID)
+		err := c.discover(ctx, c.client, dr, instanceAddress(s), instanceLabels(s), stats, c.logger)
+		if err != nil {
+			c.logger.Info("service instance discovery failed", "node", s.Node, "service-id", s.ServiceID, "error", err)
+			// not recorded so that the discovery is retried on the next catalog change
+			continue
+		}
+		c.instances[k] = s
+	}
+}
+
+// pending reports whether the sync of services has work to do:
+// new, changed or deregistered instances, including the ones whose discovery failed.
+func (c *consulDR) pending(services []*api.CatalogService) bool {
+	if len(services) != len(c.instances) {
+		return true
+	}
+	for _, s := range services {
+		old, ok := c.instances[instanceKey(s)]
+		if !ok || instanceAddress(old) != instanceAddress(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *consulDR) deleteTargets(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, s *api.CatalogService, stats *discoveryrules.RunStats) {
+	lbls := instanceLabels(s)
+	for k, v := range ruleLabels(dr) {
+		lbls[k] = v
+	}
+	tgList := &targetv1.TargetList{}
+	err := c.client.List(ctx, tgList,
+		client.InNamespace(discoveryrules.GetTargetNamespace(dr)),
+		client.MatchingLabels(lbls),
+	)
+	if err != nil {
+		c.logger.Info("failed to list targets", "error", err)
+		return
+	}
+	for _, tg := range tgList.Items {
+		err = c.client.Delete(ctx, &tg)
+		if err != nil {
+			c.logger.Info("failed to delete target", "name", tg.GetName(), "error", err)
+			continue
+		}
+		stats.TargetDeleted()
+		c.logger.Info("deleted target", "name", tg.GetName())
+	}
+}
+
+// loadInstances rebuilds the known service instances from the targets of the discovery rule,
+// so that the instances deregistered while the rule was not running are removed on the first sync.
+func (c *consulDR) loadInstances(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) error {
+	tgList := &targetv1.TargetList{}
+	err := c.client.List(ctx, tgList,
+		client.InNamespace(discoveryrules.GetTargetNamespace(dr)),
+		client.MatchingLabels(ruleLabels(dr)),
+	)
+	if err != nil {
+		return err
+	}
+	for _, tg := range tgList.Items {
+		lbls := tg.GetLabels()
+		s := &api.CatalogService{
+			Node:      lbls[LabelKeyConsulNode],
+			ServiceID: lbls[LabelKeyConsulServiceID],
+		}
+		if s.Node == "" || s.ServiceID == "" {
+			continue
+		}
+		if tg.Spec.Properties != nil && tg.Spec.Properties.Config != nil {
+			s.Address, _, _ = net.SplitHostPort(tg.Spec.Properties.Config.Address)
+		}
+		c.instances[instanceKey(s)] = s
+	}
+	return nil
+}
+
+// instanceKey identifies a service instance by its node and service ID label values,
+// which is all the instances loaded from the targets know about them.
+func instanceKey(s *api.CatalogService) string {
+	return labelValue(s.Node) + "/" + labelValue(s.ServiceID)
+}
+
+// instanceAddress returns the service address if set,
+// otherwise the address of the node the service is registered on.
+func instanceAddress(s *api.CatalogService) string {
+	if s.ServiceAddress != "" {
+		return s.ServiceAddress
+	}
+	return s.Address
+}
+
+func instanceLabels(s *api.CatalogService) map[string]string {
+	return map[string]string{
+		LabelKeyConsulNode:      labelValue(s.Node),
+		LabelKeyConsulServiceID: labelValue(s.ServiceID),
+	}
+}
+
+func ruleLabels(dr *discoveryv1alpha1.DiscoveryRule) map[string]string {
+	return map[string]string{
+		discoveryv1alpha1.LabelKeyDiscoveryRule:          dr.GetName(),
+		discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace: dr.GetNamespace(),
+	}
+}
+
+// labelValue converts a Consul node name or service ID, which commonly contains ':',
+// into a valid label value. Values longer than a label value allows are truncated
+// and suffixed with a hash of the original value to keep them unique.
+func labelValue(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			b[i] = '-'
+		}
+	}
+	v := string(b)
+	if len(v) > validation.LabelValueMaxLength {
+		h := fnv.New32a()
+		h.Write([]byte(s))
+		suffix := fmt.Sprintf("-%08x", h.Sum32())
+		v = strings.TrimRight(v[:validation.LabelValueMaxLength-len(suffix)], "-_.") + suffix
+	}
+	return strings.Trim(v, "-_.")
+}
@@ -0,0 +1,426 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "valid", in: "leaf1.dc1", want: "leaf1.dc1"},
+		{name: "colon", in: "gnmi:leaf1:57400", want: "gnmi-leaf1-57400"},
+		{name: "leading and trailing invalid characters", in: "_leaf1:", want: "leaf1"},
+	}
+	for _, tt := range tests {
+		if got := labelValue(tt.in); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	long := strings.Repeat("a", 70)
+	got := labelValue(long)
+	if len(got) != 63 || !strings.HasPrefix(got, strings.Repeat("a", 54)+"-") {
+		t.Errorf("got %q, want a truncated value with a hash suffix", got)
+	}
+	if got == labelValue(long+"b") {
+		t.Error("truncated label values of different values are equal")
+	}
+}
+
+func TestRun(t *testing.T) {
+	node1 := map[string]interface{}{"Node": "node1", "Address": "10.0.0.1", "ServiceID": "svc:1", "ServiceName": "gnmi"}
+	node2 := map[string]interface{}{"Node": "node2", "Address": "10.0.0.2", "ServiceID": "svc:2", "ServiceName": "gnmi"}
+	var mu sync.Mutex
+	queries := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/catalog/service/gnmi" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		queries++
+		n := queries
+		mu.Unlock()
+		var index string
+		var rsp []interface{}
+		switch {
+		case n == 1:
+			index, rsp = "10", []interface{}{node1, node2}
+		case n == 2:
+			// blocking query timed out without changes
+			time.Sleep(10 * time.Millisecond)
+			index, rsp = "10", []interface{}{node1, node2}
+		case r.URL.Query().Get("index") == "20":
+			time.Sleep(10 * time.Millisecond)
+			index, rsp = "20", []interface{}{node1}
+		default:
+			index, rsp = "20", []interface{}{node1}
+		}
+		w.Header().Set("X-Consul-Index", index)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	defer srv.Close()
+
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			ConsulRule: &discoveryv1alpha1.ConsulRule{Address: srv.URL, Service: "gnmi"},
+		},
+	}
+	// target of an instance deregistered while the rule was not running
+	leaked := newTarget(dr, "node3", instanceLabels(&api.CatalogService{Node: "node3", ServiceID: "svc:3"}), "10.0.0.3")
+	// target of the same instance discovered by another rule
+	other := newTarget(dr, "node3.dr2", instanceLabels(&api.CatalogService{Node: "node3", ServiceID: "svc:3"}), "10.0.0.3")
+	other.Labels[discoveryv1alpha1.LabelKeyDiscoveryRule] = "dr2"
+
+	cl := newClient(t, dr, leaked, other)
+
+	attempts := make(map[string]int)
+	c := &consulDR{
+		discover: func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error {
+			mu.Lock()
+			attempts[ip]++
+			n := attempts[ip]
+			mu.Unlock()
+			if ip == "10.0.0.1" && n == 1 {
+				return discoveryrules.ErrHostUnreachable
+			}
+			return c.Create(ctx, newTarget(dr, drLabels[LabelKeyConsulNode], drLabels, ip))
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(ctx, dr,
+			discoveryrules.WithClient(cl),
+			discoveryrules.WithLogger(logging.NewNopLogger()),
+		)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := queries > 3
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("consul catalog not queried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+
+	if attempts["10.0.0.1"] != 2 || attempts["10.0.0.2"] != 1 {
+		t.Errorf("unexpected discovery attempts %v", attempts)
+	}
+	tgList := &targetv1.TargetList{}
+	if err := cl.List(context.Background(), tgList); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tg := range tgList.Items {
+		names = append(names, tg.GetName())
+	}
+	if len(names) != 2 || !contains(names, "node1") || !contains(names, "node3.dr2") {
+		t.Errorf("unexpected targets %v", names)
+	}
+}
+
+func TestRunNow(t *testing.T) {
+	node1 := map[string]interface{}{"Node": "node1", "Address": "10.0.0.1", "ServiceID": "svc:1", "ServiceName": "gnmi"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("index") != "" {
+			// blocking query without catalog change
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("X-Consul-Index", "10")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]interface{}{node1})
+	}))
+	defer srv.Close()
+
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			ConsulRule: &discoveryv1alpha1.ConsulRule{Address: srv.URL, Service: "gnmi"},
+		},
+	}
+	cl := newClient(t, dr)
+	discovered := make(chan string, 2)
+	trigger := make(chan string, 1)
+	c := &consulDR{
+		discover: func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error {
+			discovered <- ip
+			return nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(ctx, dr,
+			discoveryrules.WithClient(cl),
+			discoveryrules.WithLogger(logging.NewNopLogger()),
+			discoveryrules.WithTrigger(trigger),
+		)
+	}()
+	defer func() {
+		cancel()
+		<-errCh
+	}()
+
+	for n := 0; n < 2; n++ {
+		select {
+		case <-discovered:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("service instance discovery %d not run", n+1)
+		}
+		if n == 0 {
+			// interrupts the blocking query
+			trigger <- "2022-06-01T10:00:00Z"
+		}
+	}
+	got := &discoveryv1alpha1.DiscoveryRule{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(dr), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.RunNowTrigger != "2022-06-01T10:00:00Z" {
+		t.Errorf("got run now trigger %q, want the handled request", got.Status.RunNowTrigger)
+	}
+}
+
+func TestRunUnchanged(t *testing.T) {
+	node1 := map[string]interface{}{"Node": "node1", "Address": "10.0.0.1", "ServiceID": "svc:1", "ServiceName": "gnmi"}
+	var mu sync.Mutex
+	queries := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries++
+		mu.Unlock()
+		if r.URL.Query().Get("index") != "" {
+			// blocking query timed out without changes
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Header().Set("X-Consul-Index", "10")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]interface{}{node1})
+	}))
+	defer srv.Close()
+
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			ConsulRule: &discoveryv1alpha1.ConsulRule{Address: srv.URL, Service: "gnmi"},
+		},
+	}
+	cl := &countingClient{Client: newClient(t, dr)}
+	discovered := 0
+	c := &consulDR{
+		discover: func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error {
+			mu.Lock()
+			discovered++
+			mu.Unlock()
+			return nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(ctx, dr,
+			discoveryrules.WithClient(cl),
+			discoveryrules.WithLogger(logging.NewNopLogger()),
+		)
+	}()
+	waitFor(t, &mu, func() bool { return queries > 4 })
+	cancel()
+	<-errCh
+
+	if discovered != 1 {
+		t.Errorf("got %d discoveries, want 1", discovered)
+	}
+	// the started and finished status updates of the first sync
+	if n := cl.statusUpdates(); n != 2 {
+		t.Errorf("got %d status updates, want 2", n)
+	}
+}
+
+func TestRunStartRetry(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = 10 * time.Millisecond
+
+	node1 := map[string]interface{}{"Node": "node1", "Address": "10.0.0.1", "ServiceID": "svc:1", "ServiceName": "gnmi"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("index") != "" {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("X-Consul-Index", "10")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]interface{}{node1})
+	}))
+	defer srv.Close()
+
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			ConsulRule: &discoveryv1alpha1.ConsulRule{Address: srv.URL, Service: "gnmi", TokenSecret: "consul-token"},
+		},
+	}
+	// the token secret is created after the rule started
+	cl := newClient(t, dr)
+	discovered := make(chan string, 1)
+	c := &consulDR{
+		discover: func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error {
+			discovered <- ip
+			return nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(ctx, dr,
+			discoveryrules.WithClient(cl),
+			discoveryrules.WithLogger(logging.NewNopLogger()),
+		)
+	}()
+	// retryInterval is restored once Run returned
+	defer func() {
+		cancel()
+		<-errCh
+	}()
+	time.Sleep(50 * time.Millisecond)
+	err := cl.Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "consul-token", Namespace: "default"},
+		Data:       map[string][]byte{tokenSecretKey: []byte("token")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-discovered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("service instance not discovered after the token secret was created")
+	}
+}
+
+// countingClient counts the status updates
+type countingClient struct {
+	client.Client
+	m       sync.Mutex
+	updates int
+}
+
+func (c *countingClient) Status() client.StatusWriter {
+	return &countingStatusWriter{StatusWriter: c.Client.Status(), c: c}
+}
+
+func (c *countingClient) statusUpdates() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.updates
+}
+
+type countingStatusWriter struct {
+	client.StatusWriter
+	c *countingClient
+}
+
+func (w *countingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	w.c.m.Lock()
+	w.c.updates++
+	w.c.m.Unlock()
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func waitFor(t *testing.T, mu *sync.Mutex, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := cond()
+		mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := targetv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := discoveryv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newTarget(dr *discoveryv1alpha1.DiscoveryRule, name string, lbls map[string]string, ip string) *targetv1.Target {
+	tg := &targetv1.Target{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: dr.GetNamespace(),
+			Labels:    ruleLabels(dr),
+		},
+		Spec: targetv1.TargetSpec{
+			Properties: &targetv1.TargetProperties{
+				Config: &targetv1.TargetConfig{Address: ip + ":57400"},
+			},
+		},
+	}
+	for k, v := range lbls {
+		tg.Labels[k] = v
+	}
+	return tg
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package discovery_rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/netconf"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// credentials secret keys
+const (
+	usernameKey = "username"
+	passwordKey = "password"
+)
+
+// errCredentialsRejected is wrapped by the discovery functions passed to tryCredentials
+// when the target does not accept the credentials.
+var errCredentialsRejected = errors.New("credentials rejected")
+
+// discoverFunc discovers a target using the credentials stored in secret
+type discoverFunc func(secret *corev1.Secret) (*targetv1.DiscoveryInfo, error)
+
+// tryCredentials calls discover with the credentials of the discovery rule selecting ip, in order,
+// until the target accepts them and they are allowed for the discovered vendor type.
+// It returns the discovery info and the name of the credentials secret used.
+func tryCredentials(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, logger logging.Logger, discover discoverFunc) (*targetv1.DiscoveryInfo, string, error) {
+	refs, err := credentialsCandidates(dr, ip)
+	if err != nil {
+		return nil, "", err
+	}
+	var lastErr error
+	for _, ref := range refs {
+		secret, err := getCredentialsSecret(ctx, c, dr.GetNamespace(), ref.Name)
+		if err != nil {
+			// a missing secret does not prevent trying the next credentials
+			logger.Info("failed to get credentials", "IP", ip, "credentials", ref.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		di, err := discover(secret)
+		if err != nil {
+			if !errors.Is(err, errCredentialsRejected) {
+				return nil, "", err
+			}
+			logger.Debug("credentials rejected", "IP", ip, "credentials", ref.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		if !matchesVendorType(ref, di.VendorType) {
+			logger.Debug("credentials not allowed for vendor type", "IP", ip, "credentials", ref.Name, "vendorType", di.VendorType)
+			lastErr = fmt.Errorf("credentials %s not allowed for vendor type %s", ref.Name, di.VendorType)
+			continue
+		}
+		return di, ref.Name, nil
+	}
+	return nil, "", fmt.Errorf("no credentials accepted by the target: %w", lastErr)
+}
+
+// targetCredentials returns the credentials set in a target discovered without them:
+// the first credentials of the discovery rule selecting ip and allowed for the vendor type.
+func targetCredentials(dr *discoveryv1alpha1.DiscoveryRule, ip string, vendorType targetv1.VendorType) (string, error) {
+	refs, err := credentialsCandidates(dr, ip)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if matchesVendorType(ref, vendorType) {
+			return ref.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no credentials allowed for vendor type %s", vendorType)
+}
+
+// credentialsCandidates returns the credentials to try on ip, in order:
+// the discovery rule credentials followed by the credentials list entries selecting ip.
+func credentialsCandidates(dr *discoveryv1alpha1.DiscoveryRule, ip string) ([]discoveryv1alpha1.CredentialsRef, error) {
+	refs := make([]discoveryv1alpha1.CredentialsRef, 0, 1+len(dr.Spec.CredentialsList))
+	if dr.Spec.Credentials != "" {
+		refs = append(refs, discoveryv1alpha1.CredentialsRef{Name: dr.Spec.Credentials})
+	}
+	for _, ref := range dr.Spec.CredentialsList {
+		ok, err := matchesIP(ref, ip)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no credentials selecting %s", ip)
+	}
+	return refs, nil
+}
+
+// matchesIP reports whether ip is within one of the credentials CIDRs,
+// credentials without CIDRs match any address.
+func matchesIP(ref discoveryv1alpha1.CredentialsRef, ip string) (bool, error) {
+	if len(ref.CIDRs) == 0 {
+		return true, nil
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false, nil
+	}
+	for _, cidr := range ref.CIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, fmt.Errorf("credentials %s: %w", ref.Name, err)
+		}
+		if ipNet.Contains(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchesVendorType reports whether the credentials may be used for the vendor type,
+// credentials without vendor types match any vendor.
+func matchesVendorType(ref discoveryv1alpha1.CredentialsRef, vendorType targetv1.VendorType) bool {
+	if len(ref.VendorTypes) == 0 {
+		return true
+	}
+	for _, vt := range ref.VendorTypes {
+		if vt == vendorType {
+			return true
+		}
+	}
+	return false
+}
+
+// isAuthError reports whether a gNMI RPC or an SSH handshake failed on authentication
+func isAuthError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return true
+	}
+	return errors.Is(err, netconf.ErrAuthFailed)
+}
+
+func getCredentialsSecret(ctx context.Context, c client.Client, namespace, name string) (*corev1.Secret, error) {
+	creds := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}, creds)
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
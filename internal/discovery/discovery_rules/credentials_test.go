@@ -0,0 +1,180 @@
+package discovery_rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/netconf"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCredentialsCandidates(t *testing.T) {
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			Credentials: "default",
+			CredentialsList: []discoveryv1alpha1.CredentialsRef{
+				{Name: "site1", CIDRs: []string{"10.0.1.0/24", "2001:db8:1::/48"}},
+				{Name: "site2", CIDRs: []string{"10.0.2.0/24"}},
+				{Name: "srl", VendorTypes: []targetv1.VendorType{targetv1.VendorTypeNokiaSRL}},
+			},
+		},
+	}
+	tests := []struct {
+		ip   string
+		want []string
+	}{
+		{ip: "10.0.1.10", want: []string{"default", "site1", "srl"}},
+		{ip: "10.0.2.10", want: []string{"default", "site2", "srl"}},
+		{ip: "2001:db8:1::1", want: []string{"default", "site1", "srl"}},
+		{ip: "10.0.3.10", want: []string{"default", "srl"}},
+		{ip: "router1.example.com", want: []string{"default", "srl"}},
+	}
+	for _, tt := range tests {
+		refs, err := credentialsCandidates(dr, tt.ip)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.ip, err)
+		}
+		got := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			got = append(got, ref.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got credentials %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	dr.Spec.Credentials = ""
+	dr.Spec.CredentialsList = []discoveryv1alpha1.CredentialsRef{{Name: "site1", CIDRs: []string{"10.0.1.0/24"}}}
+	if _, err := credentialsCandidates(dr, "10.0.2.10"); err == nil {
+		t.Error("expected an error when no credentials select the IP")
+	}
+	dr.Spec.CredentialsList[0].CIDRs = []string{"10.0.1.0"}
+	if _, err := credentialsCandidates(dr, "10.0.2.10"); err == nil {
+		t.Error("expected an error on an invalid CIDR")
+	}
+}
+
+func TestTargetCredentials(t *testing.T) {
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			CredentialsList: []discoveryv1alpha1.CredentialsRef{
+				{Name: "srl", VendorTypes: []targetv1.VendorType{targetv1.VendorTypeNokiaSRL}},
+				{Name: "site1", CIDRs: []string{"10.0.1.0/24"}},
+			},
+		},
+	}
+	tests := []struct {
+		ip         string
+		vendorType targetv1.VendorType
+		want       string
+		wantErr    bool
+	}{
+		{ip: "10.0.1.10", vendorType: targetv1.VendorTypeNokiaSRL, want: "srl"},
+		{ip: "10.0.1.10", vendorType: "aristaeos", want: "site1"},
+		{ip: "10.0.2.10", vendorType: "aristaeos", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := targetCredentials(dr, tt.ip, tt.vendorType)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s %s: unexpected error: %v", tt.ip, tt.vendorType, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: got credentials %q, want %q", tt.ip, tt.vendorType, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesVendorType(t *testing.T) {
+	ref := discoveryv1alpha1.CredentialsRef{Name: "srl", VendorTypes: []targetv1.VendorType{targetv1.VendorTypeNokiaSRL}}
+	if !matchesVendorType(ref, targetv1.VendorTypeNokiaSRL) {
+		t.Error("expected the credentials to match their vendor type")
+	}
+	if matchesVendorType(ref, targetv1.VendorTypeNokiaSROS) {
+		t.Error("expected the credentials not to match another vendor type")
+	}
+	if !matchesVendorType(discoveryv1alpha1.CredentialsRef{Name: "any"}, targetv1.VendorTypeNokiaSROS) {
+		t.Error("expected credentials without vendor types to match any vendor type")
+	}
+}
+
+func TestTryCredentials(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	newSecret := func(name, username string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Data:       map[string][]byte{usernameKey: []byte(username)},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newSecret("rejected", "guest"),
+		newSecret("valid", "admin"),
+	).Build()
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			CredentialsList: []discoveryv1alpha1.CredentialsRef{
+				{Name: "missing"},
+				{Name: "rejected"},
+				{Name: "valid", CIDRs: []string{"10.0.0.0/24"}},
+			},
+		},
+	}
+	var tried []string
+	discover := func(secret *corev1.Secret) (*targetv1.DiscoveryInfo, error) {
+		tried = append(tried, secret.GetName())
+		if string(secret.Data[usernameKey]) != "admin" {
+			return nil, fmt.Errorf("%w: invalid username", errCredentialsRejected)
+		}
+		return &targetv1.DiscoveryInfo{VendorType: targetv1.VendorTypeNokiaSRL}, nil
+	}
+
+	_, credentials, err := tryCredentials(context.Background(), c, dr, "10.0.0.1", logging.NewNopLogger(), discover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials != "valid" {
+		t.Errorf("got credentials %q, want valid", credentials)
+	}
+	if !reflect.DeepEqual(tried, []string{"rejected", "valid"}) {
+		t.Errorf("got credentials tried %v", tried)
+	}
+
+	// only the missing and rejected credentials select the IP
+	_, _, err = tryCredentials(context.Background(), c, dr, "10.0.1.1", logging.NewNopLogger(), discover)
+	if !errors.Is(err, errCredentialsRejected) {
+		t.Errorf("got error %v, want %v", err, errCredentialsRejected)
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "gNMI unauthenticated", err: status.Error(codes.Unauthenticated, "invalid credentials"), want: true},
+		{name: "gNMI permission denied", err: status.Error(codes.PermissionDenied, "not allowed"), want: true},
+		{name: "gNMI unavailable", err: status.Error(codes.Unavailable, "connection refused"), want: false},
+		{name: "SSH authentication", err: fmt.Errorf("%w: ssh: handshake failed", netconf.ErrAuthFailed), want: true},
+		{name: "SSH handshake", err: errors.New("ssh: handshake failed: unable to authenticate"), want: false},
+	}
+	for _, tt := range tests {
+		if got := isAuthError(tt.err); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
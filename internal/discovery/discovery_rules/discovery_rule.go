@@ -2,8 +2,11 @@ package discovery_rules
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,26 +15,51 @@ import (
 	"github.com/openconfig/gnmi/proto/gnmi"
 	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
 	"github.com/yndd/discovery/internal/discovery/discoverers"
+	"github.com/yndd/discovery/internal/discovery/discoverers/profile_discoverer"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	targetv1 "github.com/yndd/target/apis/target/v1"
+	"google.golang.org/grpc"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 const (
 	IPRangeDiscoveryRule   = "ipRange"
 	TopoWatchDiscoveryRule = "topoWatch"
+	APIDiscoveryRule       = "apiRule"
+	NetBoxDiscoveryRule    = "netbox"
+	ConsulDiscoveryRule    = "consul"
 )
 
+const (
+	defaultGNMIPort    = 57400
+	defaultNetconfPort = 830
+)
+
+// ErrUnknownVendor is returned when no discoverer supports the target
+var ErrUnknownVendor = errors.New("unknown target vendor")
+
+// ErrHostUnreachable is returned when the host does not answer the discovery protocol
+var ErrHostUnreachable = errors.New("host unreachable")
+
+// ErrTargetConflict is returned by ApplyTarget when fields it sets
+// are managed by another field manager.
+var ErrTargetConflict = errors.New("conflict applying target")
+
 type DiscoveryRule interface {
 	Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, opts ...Option) error
 	Stop() error
 	//
 	SetLogger(logger logging.Logger)
 	SetClient(c client.Client)
+	// SetTrigger sets the channel on which run now requests are received,
+	// the values are the run now annotations of the discovery rule
+	SetTrigger(trigger <-chan string)
 }
 
 type Initializer func() DiscoveryRule
@@ -56,137 +84,421 @@ func WithClient(c client.Client) Option {
 	}
 }
 
-func GetDiscovererGNMI(capRsp *gnmi.CapabilityResponse) (discoverers.Discoverer, error) {
-	var discoverer discoverers.Discoverer
-OUTER:
-	for _, m := range capRsp.SupportedModels {
-		switch m.Organization {
-		case "Nokia":
-			if strings.Contains(m.Name, "srl_nokia") {
-				// SRL
-				init := discoverers.Discoverers[discoverers.NokiaSRLDiscovererName]
-				discoverer = init()
-			} else {
-				// SROS
-				init := discoverers.Discoverers[discoverers.NokiaSROSDiscovererName]
-				discoverer = init()
-			}
-			break OUTER
+func WithTrigger(trigger <-chan string) Option {
+	return func(d DiscoveryRule) {
+		d.SetTrigger(trigger)
+	}
+}
+
+// GetDiscovererGNMI returns the discoverer of the target from its capabilities.
+// The discoverer pinned in the discovery rule is used if set, otherwise the DiscovererProfiles
+// are consulted before the built-in discoverer with the highest detection score.
+func GetDiscovererGNMI(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, capRsp *gnmi.CapabilityResponse, logger logging.Logger) (discoverers.Discoverer, error) {
+	if name := dr.Spec.Discoverer; name != "" {
+		if init, ok := discoverers.Discoverers[name]; ok {
+			return init(), nil
+		}
+		profile := &discoveryv1alpha1.DiscovererProfile{}
+		err := c.Get(ctx, types.NamespacedName{Name: name}, profile)
+		if err != nil {
+			return nil, fmt.Errorf("unknown discoverer %q: %w", name, err)
 		}
+		err = profile_discoverer.Validate(profile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid discoverer profile %q: %w", name, err)
+		}
+		return profile_discoverer.New(profile), nil
+	}
+	profile, err := profile_discoverer.Lookup(ctx, c, capRsp, logger)
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil {
+		return profile_discoverer.New(profile), nil
 	}
+	discoverer := discoverers.Detect(capRsp)
 	if discoverer == nil {
-		return nil, errors.New("unknown target vendor")
+		return nil, ErrUnknownVendor
 	}
 	return discoverer, nil
 }
 
+// ApplyTarget creates or updates the target of the discovered device using server-side apply,
+// under the discovery field manager. Fields managed by other controllers are not overwritten,
+// a conflict on a field discovery sets is returned as an error.
+// With the DiscoveryInfo sync policy, only the discovery info of an existing target is updated.
+// The target is labeled with the discovery rule and owned by it if cascade deletion is enabled.
 func ApplyTarget(ctx context.Context,
 	c client.Client, dr *discoveryv1alpha1.DiscoveryRule,
-	di *targetv1.DiscoveryInfo, t *target.Target,
+	di *targetv1.DiscoveryInfo, tc *targetv1.TargetConfig,
 	drLabels map[string]string,
-) error {
-	var namespace string
-	if dr.Spec.TargetTemplate != nil {
-		namespace = dr.Spec.TargetTemplate.Namespace
-	}
-	if namespace == "" {
-		namespace = dr.GetNamespace()
-	}
-	targetName := fmt.Sprintf("%s.%s.%s", di.HostName, strings.Fields(di.SerialNumber)[0], di.MacAddress)
-	targetName = strings.ReplaceAll(targetName, ":", "-")
-	targetName = strings.ToLower(targetName)
+) (controllerutil.OperationResult, error) {
+	namespace := GetTargetNamespace(dr)
 	targetSpec := targetv1.TargetSpec{
 		Properties: &targetv1.TargetProperties{
 			VendorType: di.VendorType,
-			Config: &targetv1.TargetConfig{
-				Address:           t.Config.Address,
-				CredentialName:    dr.Spec.Credentials,
-				Encoding:          "",
-				Insecure:          *t.Config.Insecure,
-				Protocol:          targetv1.Protocol(targetv1.Protocol_GNMI),
-				SkipVerify:        *t.Config.SkipVerify,
-				TlsCredentialName: "",
-			},
+			Config:     tc,
 			// Allocation: map[string]*targetv1.Allocation{},
 		},
 		DiscoveryInfo: di,
 	}
+	targetName, err := dr.GetTargetName(&targetSpec)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	labels, err := dr.GetTargetLabels(&targetSpec)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	// merge discovery rule implementation labels
+	for k, v := range drLabels {
+		labels[k] = v
+	}
+	// ownership labels, the templates cannot override them
+	labels[discoveryv1alpha1.LabelKeyDiscoveryRule] = dr.GetName()
+	labels[discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace] = dr.GetNamespace()
+	anno, err := dr.GetTargetAnnotations(&targetSpec)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	targetCR := &targetv1.Target{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        targetName,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: anno,
+		},
+		Spec: targetSpec,
+	}
+	if dr.Spec.CascadeDelete && namespace == dr.GetNamespace() {
+		err = controllerutil.SetOwnerReference(dr, targetCR, c.Scheme())
+		if err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+	}
 
-	// check if the target already exists
-	targetCR := &targetv1.Target{}
-	err := c.Get(ctx, types.NamespacedName{
+	// the existing target tells apart creations, updates and no-op applies
+	existing := &targetv1.Target{}
+	err = c.Get(ctx, types.NamespacedName{
 		Namespace: namespace,
 		Name:      targetName,
-	}, targetCR)
+	}, existing)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return controllerutil.OperationResultNone, err
+	}
+	if existing.GetResourceVersion() != "" && dr.Spec.SyncPolicy == discoveryv1alpha1.SyncPolicyDiscoveryInfo {
+		targetCR = discoveryInfoOnly(existing, targetCR)
+	}
+	gvk, err := apiutil.GVKForObject(targetCR, c.Scheme())
 	if err != nil {
-		if kerrors.IsNotFound(err) {
-			labels, err := dr.GetTargetLabels(&targetSpec)
-			if err != nil {
-				return err
-			}
-			// merge discovery rule implementation labels
-			for k, v := range drLabels {
-				labels[k] = v
-			}
+		return controllerutil.OperationResultNone, err
+	}
+	targetCR.SetGroupVersionKind(gvk)
+	opts := []client.PatchOption{client.FieldOwner(discoveryv1alpha1.FieldManager)}
+	if adoptTarget(dr, existing) {
+		// targets written before discovery used server-side apply are owned by
+		// an update field manager, the first apply takes over the fields discovery sets
+		opts = append(opts, client.ForceOwnership)
+	}
+	err = c.Patch(ctx, targetCR, client.Apply, opts...)
+	// vendor types not defined by the target API are rejected by target CRDs validating them,
+	// the target is applied again with the unknown vendor type
+	if vendorTypeRejected(err) && unknownVendorType(targetCR) {
+		err = c.Patch(ctx, targetCR, client.Apply, opts...)
+	}
+	if err != nil {
+		if kerrors.IsConflict(err) {
+			return controllerutil.OperationResultNone, fmt.Errorf("%w %s/%s: %v", ErrTargetConflict, namespace, targetName, err)
+		}
+		return controllerutil.OperationResultNone, err
+	}
+	switch existing.GetResourceVersion() {
+	case "":
+		return controllerutil.OperationResultCreated, nil
+	case targetCR.GetResourceVersion():
+		return controllerutil.OperationResultNone, nil
+	}
+	return controllerutil.OperationResultUpdated, nil
+}
 
-			anno, err := dr.GetTargetAnnotations(&targetSpec)
-			if err != nil {
-				return err
-			}
-			targetCR = &targetv1.Target{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        targetName,
-					Namespace:   namespace,
-					Labels:      labels,
-					Annotations: anno,
-				},
-				Spec: targetSpec,
-			}
-			return c.Create(ctx, targetCR)
-		} else {
-			return err
+// adoptTarget reports whether the existing target was created by the discovery rule
+// but never applied by the discovery field manager.
+func adoptTarget(dr *discoveryv1alpha1.DiscoveryRule, existing *targetv1.Target) bool {
+	if existing.GetResourceVersion() == "" {
+		return false
+	}
+	lbls := existing.GetLabels()
+	if lbls[discoveryv1alpha1.LabelKeyDiscoveryRule] != dr.GetName() {
+		return false
+	}
+	// targets created before the namespace label was introduced only carry the rule name
+	if ns, ok := lbls[discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace]; ok && ns != dr.GetNamespace() {
+		return false
+	}
+	return appliedFields(existing) == nil
+}
+
+// discoveryInfoOnly returns the object applied to an existing target with the DiscoveryInfo sync policy:
+// the new discovery info, the current target properties and the labels and annotations discovery
+// applied before. Leaving out fields discovery manages would remove them from the target.
+func discoveryInfoOnly(existing, desired *targetv1.Target) *targetv1.Target {
+	fields := appliedFields(existing)
+	return &targetv1.Target{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            existing.GetName(),
+			Namespace:       existing.GetNamespace(),
+			Labels:          ownedEntries(existing.GetLabels(), fields, "f:labels"),
+			Annotations:     ownedEntries(existing.GetAnnotations(), fields, "f:annotations"),
+			OwnerReferences: desired.GetOwnerReferences(),
+		},
+		Spec: targetv1.TargetSpec{
+			Properties:    existing.Spec.Properties,
+			DiscoveryInfo: desired.Spec.DiscoveryInfo,
+		},
+	}
+}
+
+// appliedFields returns the fields of the target applied by the discovery field manager,
+// nil if discovery never applied it.
+func appliedFields(t *targetv1.Target) map[string]interface{} {
+	for _, mf := range t.GetManagedFields() {
+		if mf.Manager != discoveryv1alpha1.FieldManager || mf.Operation != metav1.ManagedFieldsOperationApply {
+			continue
 		}
+		fields := map[string]interface{}{}
+		if mf.FieldsV1 != nil {
+			// an undecodable field set is handled as an empty one
+			_ = json.Unmarshal(mf.FieldsV1.Raw, &fields)
+		}
+		return fields
 	}
-	// target already exists
-	targetCR.Spec.DiscoveryInfo = di
-	return c.Update(ctx, targetCR)
+	return nil
 }
 
-func Initialize(dr *discoveryv1alpha1.DiscoveryRule) DiscoveryRule {
-	var ruleName string
+// ownedEntries returns the entries of the metadata map, labels or annotations,
+// listed in the managed fields.
+func ownedEntries(m map[string]string, fields map[string]interface{}, key string) map[string]string {
+	metadata, _ := fields["f:metadata"].(map[string]interface{})
+	owned, _ := metadata[key].(map[string]interface{})
+	if len(owned) == 0 {
+		return nil
+	}
+	entries := make(map[string]string, len(owned))
+	for k := range owned {
+		k = strings.TrimPrefix(k, "f:")
+		if v, ok := m[k]; ok {
+			entries[k] = v
+		}
+	}
+	return entries
+}
+
+// targetAddress returns the host:port address of the target, IPv6 addresses are enclosed in brackets
+func targetAddress(ip string, port uint) string {
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// vendorTypeRejected reports whether err is the validation error of a target vendor type
+func vendorTypeRejected(err error) bool {
+	if !kerrors.IsInvalid(err) {
+		return false
+	}
+	var status kerrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if strings.HasSuffix(cause.Field, ".vendorType") {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownVendorType sets the vendor types of t not defined by the target API to unknown,
+// it reports whether a vendor type was changed
+func unknownVendorType(t *targetv1.Target) bool {
+	var changed bool
+	if p := t.Spec.Properties; p != nil && !apiVendorType(p.VendorType) {
+		p.VendorType = targetv1.VendorTypeUnknown
+		changed = true
+	}
+	if di := t.Spec.DiscoveryInfo; di != nil && !apiVendorType(di.VendorType) {
+		di.VendorType = targetv1.VendorTypeUnknown
+		changed = true
+	}
+	return changed
+}
+
+func apiVendorType(vt targetv1.VendorType) bool {
+	switch vt {
+	case "", targetv1.VendorTypeUnknown, targetv1.VendorTypeNokiaSRL, targetv1.VendorTypeNokiaSROS:
+		return true
+	}
+	return false
+}
+
+// targetPort returns the port of the discovery protocol, set in the discovered targets
+func targetPort(dr *discoveryv1alpha1.DiscoveryRule) uint {
+	switch {
+	case dr.Spec.Port != 0:
+		return dr.Spec.Port
+	case dr.Spec.Protocol == "netconf":
+		return defaultNetconfPort
+	}
+	return defaultGNMIPort
+}
+
+// GetTargetNamespace returns the namespace where the discovery rule creates targets
+func GetTargetNamespace(dr *discoveryv1alpha1.DiscoveryRule) string {
+	if dr.Spec.TargetTemplate != nil && dr.Spec.TargetTemplate.Namespace != "" {
+		return dr.Spec.TargetTemplate.Namespace
+	}
+	return dr.GetNamespace()
+}
+
+// RuleType returns the type of the discovery rule,
+// the name its implementation is registered with.
+func RuleType(dr *discoveryv1alpha1.DiscoveryRule) string {
 	switch {
 	case dr.Spec.IPRange != nil:
-		ruleName = IPRangeDiscoveryRule
+		return IPRangeDiscoveryRule
 	case dr.Spec.TopologyRule != nil:
-		ruleName = TopoWatchDiscoveryRule
+		return TopoWatchDiscoveryRule
+	case dr.Spec.APIRule != nil:
+		return APIDiscoveryRule
+	case dr.Spec.NetBoxRule != nil:
+		return NetBoxDiscoveryRule
+	case dr.Spec.ConsulRule != nil:
+		return ConsulDiscoveryRule
 	}
-	drInit, ok := DiscoveryRules[ruleName]
+	return ""
+}
+
+func Initialize(dr *discoveryv1alpha1.DiscoveryRule) DiscoveryRule {
+	drInit, ok := DiscoveryRules[RuleType(dr)]
 	if !ok {
 		return nil
 	}
 	return drInit()
 }
-func CreateTarget(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, c client.Client, ip string) (*target.Target, error) {
-	creds := &corev1.Secret{}
-	err := c.Get(ctx, types.NamespacedName{
-		Namespace: dr.GetNamespace(),
-		Name:      dr.Spec.Credentials,
-	}, creds)
+
+// Discover discovers the device reachable at ip using the discovery rule protocol
+// and creates or updates the corresponding target.
+// drLabels are added to the target labels, the discovery results are recorded in stats.
+func Discover(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *RunStats, logger logging.Logger) error {
+	stats.HostScanned()
+	err := discover(ctx, c, dr, ip, drLabels, stats, logger)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, ErrHostUnreachable):
+			stats.HostUnreachable()
+		case errors.Is(err, ErrTargetConflict):
+			stats.TargetConflict()
+		case errors.Is(err, errCredentialsRejected):
+			stats.HostAuthFailed()
+		case errors.Is(err, ErrUnknownVendor):
+			stats.HostUnknownVendor()
+		}
+		stats.HostFailed(ip, err)
+	}
+	return err
+}
+
+func discover(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *RunStats, logger logging.Logger) error {
+	switch dr.Spec.Protocol {
+	case "snmp":
+		return discoverSNMP(ctx, c, dr, ip, drLabels, stats, logger)
+	case "netconf":
+		return discoverNetconf(ctx, c, dr, ip, drLabels, stats, logger)
+	default: // gnmi
+		return discoverGNMI(ctx, c, dr, ip, drLabels, stats, logger)
+	}
+}
+
+func discoverGNMI(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *RunStats, logger logging.Logger) error {
+	logger.Info("Creating gNMI client", "IP", ip)
+	t, err := CreateTarget(ctx, dr, c, ip)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	stats.HostReachable()
+	// the gNMI credentials are sent with every RPC, they are tried on the same connection
+	di, credentials, err := tryCredentials(ctx, c, dr, ip, logger, func(secret *corev1.Secret) (*targetv1.DiscoveryInfo, error) {
+		username, password := string(secret.Data[usernameKey]), string(secret.Data[passwordKey])
+		t.Config.Username = &username
+		t.Config.Password = &password
+		capRsp, err := t.Capabilities(ctx)
+		if err != nil {
+			if isAuthError(err) {
+				return nil, fmt.Errorf("%w: %v", errCredentialsRejected, err)
+			}
+			return nil, fmt.Errorf("failed capabilities request: %w", err)
+		}
+		discoverer, err := GetDiscovererGNMI(ctx, c, dr, capRsp, logger)
+		if err != nil {
+			return nil, err
+		}
+		return discoverer.Discover(ctx, dr, t)
+	})
+	if err != nil {
+		return err
+	}
+	stats.HostDiscovered()
+	b, _ := json.Marshal(di)
+	logger.Info("discovery info", "info", string(b))
+	tc := &targetv1.TargetConfig{
+		Address:           t.Config.Address,
+		CredentialName:    credentials,
+		TlsCredentialName: tlsCredentialName(dr),
+		Insecure:          *t.Config.Insecure,
+		Protocol:          targetv1.Protocol(targetv1.Protocol_GNMI),
+		SkipVerify:        *t.Config.SkipVerify,
 	}
+	op, err := ApplyTarget(ctx, c, dr, di, tc, drLabels)
+	if err != nil {
+		return err
+	}
+	stats.TargetApplied(op)
+	return nil
+}
+
+// CreateTarget creates the gNMI target of the ip and connects its gNMI client,
+// the target certificate is verified with the discovery rule certificate if set.
+// The credentials are set by the caller before issuing RPCs.
+func CreateTarget(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, c client.Client, ip string) (*target.Target, error) {
 	tOpts := []gapi.TargetOption{
-		gapi.Address(fmt.Sprintf("%s:%d", ip, dr.Spec.Port)),
-		gapi.Username(string(creds.Data["username"])),
-		gapi.Password(string(creds.Data["password"])),
+		gapi.Address(targetAddress(ip, targetPort(dr))),
 		gapi.Timeout(5 * time.Second),
 	}
-	if dr.Spec.Insecure {
+	var dOpts []grpc.DialOption
+	switch {
+	case dr.Spec.Insecure:
 		tOpts = append(tOpts, gapi.Insecure(true))
-	} else {
+	case dr.Spec.Certificate != "":
+		secret, err := getCertificateSecret(ctx, c, dr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get certificate: %w", err)
+		}
+		certOpts, certDOpts, cleanup, err := certificateOptions(secret, dr.Spec.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		// the TLS files are only read when the gNMI client connects
+		defer cleanup()
+		tOpts = append(tOpts, certOpts...)
+		dOpts = append(dOpts, certDOpts...)
+	default:
 		tOpts = append(tOpts, gapi.SkipVerify(true))
 	}
-	// TODO: query certificate, its secret and use it
-
-	return gapi.NewTarget(tOpts...)
+	t, err := gapi.NewTarget(tOpts...)
+	if err != nil {
+		return nil, err
+	}
+	err = t.CreateGNMIClient(ctx, dOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create gNMI client: %v", ErrHostUnreachable, err)
+	}
+	return t, nil
 }
@@ -0,0 +1,53 @@
+package discovery_rules
+
+import (
+	"errors"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+)
+
+func TestTargetAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.0.0.1", want: "10.0.0.1:57400"},
+		{ip: "2001:db8::1", want: "[2001:db8::1]:57400"},
+		{ip: "router1.example.com", want: "router1.example.com:57400"},
+	}
+	for _, tt := range tests {
+		if got := targetAddress(tt.ip, 57400); got != tt.want {
+			t.Errorf("%s: got address %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestTargetPort(t *testing.T) {
+	tests := []struct {
+		protocol string
+		port     uint
+		want     uint
+	}{
+		{protocol: "gnmi", want: defaultGNMIPort},
+		{protocol: "snmp", want: defaultGNMIPort},
+		{protocol: "netconf", want: defaultNetconfPort},
+		{protocol: "netconf", port: 8300, want: 8300},
+		{protocol: "gnmi", port: 6030, want: 6030},
+	}
+	for _, tt := range tests {
+		dr := &discoveryv1alpha1.DiscoveryRule{
+			Spec: discoveryv1alpha1.DiscoveryRuleSpec{Protocol: tt.protocol, Port: tt.port},
+		}
+		if got := targetPort(dr); got != tt.want {
+			t.Errorf("%s port %d: got %d, want %d", tt.protocol, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestGetDiscovererNetconfUnsupported(t *testing.T) {
+	_, err := GetDiscovererNetconf([]string{"urn:ietf:params:netconf:base:1.1", "http://openconfig.net/yang/system"})
+	if !errors.Is(err, ErrUnsupportedNetconfDevice) || !errors.Is(err, ErrUnknownVendor) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedNetconfDevice)
+	}
+}
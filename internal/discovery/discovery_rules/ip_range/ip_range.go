@@ -1,13 +1,10 @@
 package ip_range
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
-	"sort"
-	"time"
+	"sync"
 
 	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
 	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
@@ -18,6 +15,8 @@ import (
 
 const (
 	defaultConcurrentScanNumber = 1
+	defaultStaleThreshold       = 3
+	defaultMaxHosts             = 65536
 )
 
 func init() {
@@ -27,11 +26,21 @@ func init() {
 }
 
 type ipRangeDR struct {
-	client client.Client
-	logger logging.Logger
-	cfn    context.CancelFunc
+	client  client.Client
+	logger  logging.Logger
+	cfn     context.CancelFunc
+	trigger <-chan string
+
+	// number of consecutive runs in which a target was not reachable,
+	// indexed by target namespace/name
+	missedScans map[string]int
+
+	// discovers a host, discoveryrules.Discover unless set by tests
+	discover discoverFunc
 }
 
+type discoverFunc func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error
+
 func (i *ipRangeDR) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, opts ...discoveryrules.Option) error {
 	ctx, i.cfn = context.WithCancel(ctx)
 	for _, o := range opts {
@@ -40,21 +49,24 @@ func (i *ipRangeDR) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule
 	if dr.Spec.IPRange.ConcurrentScans <= 0 {
 		dr.Spec.IPRange.ConcurrentScans = defaultConcurrentScanNumber
 	}
-	i.logger = i.logger.WithValues("discovery-rule", fmt.Sprintf("%s/%s", dr.GetNamespace(), dr.GetName()))
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// run DR
-			err := i.run(ctx, dr)
-			if err != nil {
-				i.logger.Info("failed to run discovery rule", "error", err)
-			}
-			i.logger.Debug("discovery rule done, waiting for next run", "name", dr.GetName())
-			time.Sleep(dr.Spec.Period.Duration)
-		}
+	if dr.Spec.IPRange.MaxHosts <= 0 {
+		dr.Spec.IPRange.MaxHosts = defaultMaxHosts
 	}
+	if dr.Spec.IPRange.StaleThreshold <= 0 {
+		dr.Spec.IPRange.StaleThreshold = defaultStaleThreshold
+	}
+	// an invalid range fails the rule rather than every run
+	if _, err := newHostIterator(dr.Spec.IPRange); err != nil {
+		return err
+	}
+	i.missedScans = make(map[string]int)
+	if i.discover == nil {
+		i.discover = discoveryrules.Discover
+	}
+	i.logger = i.logger.WithValues("discovery-rule", fmt.Sprintf("%s/%s", dr.GetNamespace(), dr.GetName()))
+	return discoveryrules.RunPeriodically(ctx, i.client, dr, i.logger, i.trigger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+		return i.run(ctx, dr, stats)
+	})
 }
 
 func (i *ipRangeDR) Stop() error {
@@ -71,118 +83,58 @@ func (i *ipRangeDR) SetClient(c client.Client) {
 	i.client = c
 }
 
+func (i *ipRangeDR) SetTrigger(trigger <-chan string) {
+	i.trigger = trigger
+}
+
 //
-func (i *ipRangeDR) run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) error {
-	hosts, err := getHosts(dr.Spec.IPRange.CIDRs...)
+func (i *ipRangeDR) run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, stats *discoveryrules.RunStats) error {
+	hosts, err := newHostIterator(dr.Spec.IPRange)
 	if err != nil {
 		return err
 	}
-	for _, e := range dr.Spec.IPRange.Excludes {
-		excludes, err := getHosts(e)
-		if err != nil {
-			return err
-		}
-		for h := range excludes {
-			delete(hosts, h)
-		}
-	}
-	//
+	pc := discoveryrules.NewPreChecker(dr, dr.Spec.IPRange.PreCheck, i.logger)
+	m := new(sync.Mutex)
+	reached := make(map[string]struct{})
 	sem := semaphore.NewWeighted(dr.Spec.IPRange.ConcurrentScans)
-	for _, ip := range sortIPs(hosts) {
+	wg := new(sync.WaitGroup)
+	for ip, ok := hosts.Next(); ok; ip, ok = hosts.Next() {
+		// fails once the run is stopped or its deadline expires
 		err = sem.Acquire(ctx, 1)
 		if err != nil {
-			return err
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			go func(ip string) {
-				defer sem.Release(1)
-				err := i.discover(ctx, dr, ip)
-				if err != nil {
-					i.logger.Info("Failed discovery", "IP", ip, "error", err)
-					return
-				}
-			}(ip)
-		}
-	}
-	return nil
-}
-
-func incIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
 			break
 		}
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			if pc != nil && !pc.Reachable(ctx, ip) {
+				stats.HostScanned()
+				stats.HostUnreachable()
+				return
+			}
+			err := i.discover(ctx, i.client, dr, ip, nil, stats, i.logger)
+			if err != nil {
+				i.logger.Info("Failed discovery", "IP", ip, "error", err)
+			}
+			// the host is reached if it passed the pre-check or answered the discovery protocol,
+			// a failed discovery of a live host does not make its target stale
+			if pc == nil && errors.Is(err, discoveryrules.ErrHostUnreachable) {
+				return
+			}
+			m.Lock()
+			reached[ip] = struct{}{}
+			m.Unlock()
+		}(ip)
 	}
-}
-
-func getHosts(cidrs ...string) (map[string]struct{}, error) {
-	ips := make(map[string]struct{})
-	for _, cidr := range cidrs {
-		ip, ipnet, err := net.ParseCIDR(cidr)
-		if err != nil {
-			return nil, err
-		}
-
-		for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); incIP(ip) {
-			ips[ip.String()] = struct{}{}
-		}
+	// the run only completes with the in-flight discoveries, aborted by ctx when it is done
+	wg.Wait()
+	if ctx.Err() != nil {
+		// the reached targets are incomplete, stale targets are not handled
+		return fmt.Errorf("discovery rule run aborted: %w", ctx.Err())
 	}
-	return ips, nil
-}
-
-func (i *ipRangeDR) discover(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, ip string) error {
-	switch dr.Spec.Protocol {
-	case "snmp":
+	if dr.Spec.IPRange.StaleTargetPolicy == "" || dr.Spec.IPRange.StaleTargetPolicy == discoveryv1alpha1.StaleTargetPolicyIgnore {
 		return nil
-	case "netconf":
-		return nil
-	default: // gnmi
-		t, err := discoveryrules.CreateTarget(ctx, dr, i.client, ip)
-		if err != nil {
-			return err
-		}
-		i.logger.Info("Creating gNMI client", "IP", t.Config.Name)
-		err = t.CreateGNMIClient(ctx)
-		if err != nil {
-			return err
-		}
-		defer t.Close()
-		capRsp, err := t.Capabilities(ctx)
-		if err != nil {
-			return err
-		}
-		discoverer, err := discoveryrules.GetDiscovererGNMI(capRsp)
-		if err != nil {
-			return err
-		}
-		di, err := discoverer.Discover(ctx, dr, t)
-		if err != nil {
-			return err
-		}
-		b, _ := json.Marshal(di)
-		i.logger.Info("discovery info", "info", string(b))
-		return discoveryrules.ApplyTarget(ctx, i.client, dr, di, t, nil)
-	}
-}
-
-func sortIPs(hosts map[string]struct{}) []string {
-	realIPs := make([]net.IP, 0, len(hosts))
-
-	for ip := range hosts {
-		realIPs = append(realIPs, net.ParseIP(ip))
-	}
-
-	sort.Slice(realIPs, func(i, j int) bool {
-		return bytes.Compare(realIPs[i], realIPs[j]) < 0
-	})
-
-	ips := make([]string, 0, len(realIPs))
-	for _, rip := range realIPs {
-		ips = append(ips, rip.String())
 	}
-	return ips
+	return i.handleStaleTargets(ctx, dr, reached, stats)
 }
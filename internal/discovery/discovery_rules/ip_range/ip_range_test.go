@@ -0,0 +1,81 @@
+package ip_range
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	"github.com/yndd/discovery/internal/discovery/snmp"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunDeletesSilentSNMPHostTarget(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := targetv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	newTarget := func(name, address string) *targetv1.Target {
+		return &targetv1.Target{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					discoveryv1alpha1.LabelKeyDiscoveryRule:          "dr1",
+					discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace: "default",
+				},
+			},
+			Spec: targetv1.TargetSpec{
+				Properties: &targetv1.TargetProperties{
+					Config: &targetv1.TargetConfig{Address: address},
+				},
+			},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newTarget("live", "10.0.0.1:57400"),
+		newTarget("silent", "10.0.0.2:57400"),
+	).Build()
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			Protocol: "snmp",
+			IPRange: &discoveryv1alpha1.IPRangeRule{
+				CIDRs:                   []string{"10.0.0.0/30"},
+				SkipNetworkAndBroadcast: true,
+				MaxHosts:                defaultMaxHosts,
+				ConcurrentScans:         2,
+				StaleTargetPolicy:       discoveryv1alpha1.StaleTargetPolicyDelete,
+				StaleThreshold:          1,
+			},
+		},
+	}
+	i := &ipRangeDR{
+		client:      c,
+		logger:      logging.NewNopLogger(),
+		missedScans: map[string]int{},
+		discover: func(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *discoveryrules.RunStats, logger logging.Logger) error {
+			if ip == "10.0.0.2" {
+				// SNMP discovery of an agent not responding, without ICMP pre-check
+				return fmt.Errorf("%w: %v", discoveryrules.ErrHostUnreachable, snmp.ErrNoResponse)
+			}
+			return nil
+		},
+	}
+	if err := i.run(context.Background(), dr, discoveryrules.NewRunStats()); err != nil {
+		t.Fatal(err)
+	}
+	for name, wantDeleted := range map[string]bool{"live": false, "silent": true} {
+		err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, &targetv1.Target{})
+		if deleted := kerrors.IsNotFound(err); deleted != wantDeleted {
+			t.Errorf("target %s: got deleted %t, want %t (error %v)", name, deleted, wantDeleted, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package ip_range
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+)
+
+// addrRange is an inclusive range of IPv4 or IPv6 addresses
+type addrRange struct {
+	first *big.Int
+	last  *big.Int
+	// IPv4 addresses are stored on 4 bytes, IPv6 ones on 16
+	ipv4 bool
+}
+
+func (r addrRange) size() *big.Int {
+	n := new(big.Int).Sub(r.last, r.first)
+	return n.Add(n, big.NewInt(1))
+}
+
+// parseRange parses a CIDR, a start-end range or a single address.
+// skipNetBroadcast removes the network and broadcast addresses of an IPv4 CIDR,
+// the subnet-router anycast address of an IPv6 CIDR.
+func parseRange(s string, skipNetBroadcast bool) (addrRange, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return addrRange{}, err
+		}
+		ones, bits := ipNet.Mask.Size()
+		r := addrRange{ipv4: bits == 8*net.IPv4len}
+		r.first = new(big.Int).SetBytes(ipNet.IP)
+		hostBits := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		r.last = new(big.Int).Add(r.first, hostBits.Sub(hostBits, big.NewInt(1)))
+		if skipNetBroadcast {
+			// /31, /32, /127 and /128 have no network nor broadcast address
+			switch {
+			case r.ipv4 && bits-ones >= 2:
+				r.first.Add(r.first, big.NewInt(1))
+				r.last.Sub(r.last, big.NewInt(1))
+			case !r.ipv4 && bits-ones >= 2:
+				r.first.Add(r.first, big.NewInt(1))
+			}
+		}
+		return r, nil
+	}
+	start, end := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		start, end = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	first, last := net.ParseIP(start), net.ParseIP(end)
+	if first == nil || last == nil {
+		return addrRange{}, fmt.Errorf("invalid address range %q", s)
+	}
+	r := addrRange{
+		first: addrToInt(first),
+		last:  addrToInt(last),
+		ipv4:  first.To4() != nil,
+	}
+	if r.ipv4 != (last.To4() != nil) {
+		return addrRange{}, fmt.Errorf("address range %q mixes IPv4 and IPv6", s)
+	}
+	if r.first.Cmp(r.last) > 0 {
+		return addrRange{}, fmt.Errorf("address range %q ends before it starts", s)
+	}
+	return r, nil
+}
+
+func addrToInt(ip net.IP) *big.Int {
+	if ip4 := ip.To4(); ip4 != nil {
+		return new(big.Int).SetBytes(ip4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func intToAddr(n *big.Int, ipv4 bool) net.IP {
+	size := net.IPv6len
+	if ipv4 {
+		size = net.IPv4len
+	}
+	b := n.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
+
+// mergeRanges sorts the ranges, IPv4 first, and merges the overlapping or adjacent ones
+func mergeRanges(ranges []addrRange) []addrRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].ipv4 != ranges[j].ipv4 {
+			return ranges[i].ipv4
+		}
+		return ranges[i].first.Cmp(ranges[j].first) < 0
+	})
+	merged := make([]addrRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			next := new(big.Int).Add(prev.last, big.NewInt(1))
+			if prev.ipv4 == r.ipv4 && r.first.Cmp(next) <= 0 {
+				if r.last.Cmp(prev.last) > 0 {
+					prev.last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, addrRange{
+			first: new(big.Int).Set(r.first),
+			last:  new(big.Int).Set(r.last),
+			ipv4:  r.ipv4,
+		})
+	}
+	return merged
+}
+
+// subtractRanges removes the excluded ranges from the included ones,
+// both must be merged.
+func subtractRanges(include, exclude []addrRange) []addrRange {
+	result := make([]addrRange, 0, len(include))
+	for _, r := range include {
+		first := new(big.Int).Set(r.first)
+		for _, e := range exclude {
+			if e.ipv4 != r.ipv4 || e.last.Cmp(first) < 0 || e.first.Cmp(r.last) > 0 {
+				continue
+			}
+			if e.first.Cmp(first) > 0 {
+				result = append(result, addrRange{
+					first: first,
+					last:  new(big.Int).Sub(e.first, big.NewInt(1)),
+					ipv4:  r.ipv4,
+				})
+			}
+			first = new(big.Int).Add(e.last, big.NewInt(1))
+		}
+		if first.Cmp(r.last) <= 0 {
+			result = append(result, addrRange{first: first, last: r.last, ipv4: r.ipv4})
+		}
+	}
+	return result
+}
+
+// hostIterator streams the addresses of the scanned ranges in order
+type hostIterator struct {
+	ranges []addrRange
+	// index of the current range
+	idx  int
+	next *big.Int
+}
+
+// newHostIterator returns an iterator over the CIDRs and ranges of the IP range rule,
+// minus its excludes. It fails if they hold more than MaxHosts addresses.
+func newHostIterator(rule *discoveryv1alpha1.IPRangeRule) (*hostIterator, error) {
+	include := make([]addrRange, 0, len(rule.CIDRs)+len(rule.Ranges))
+	for _, cidr := range rule.CIDRs {
+		if !strings.Contains(cidr, "/") {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		r, err := parseRange(cidr, rule.SkipNetworkAndBroadcast)
+		if err != nil {
+			return nil, err
+		}
+		include = append(include, r)
+	}
+	for _, s := range rule.Ranges {
+		r, err := parseRange(s, false)
+		if err != nil {
+			return nil, err
+		}
+		include = append(include, r)
+	}
+	exclude := make([]addrRange, 0, len(rule.Excludes))
+	for _, s := range rule.Excludes {
+		r, err := parseRange(s, false)
+		if err != nil {
+			return nil, err
+		}
+		exclude = append(exclude, r)
+	}
+	ranges := subtractRanges(mergeRanges(include), mergeRanges(exclude))
+
+	total := new(big.Int)
+	for _, r := range ranges {
+		total.Add(total, r.size())
+	}
+	if rule.MaxHosts > 0 && total.Cmp(big.NewInt(rule.MaxHosts)) > 0 {
+		return nil, fmt.Errorf("ip range holds %s addresses, more than the maximum of %d", total, rule.MaxHosts)
+	}
+	it := &hostIterator{ranges: ranges}
+	if len(ranges) > 0 {
+		it.next = new(big.Int).Set(ranges[0].first)
+	}
+	return it, nil
+}
+
+// Next returns the next address, false once all the addresses were returned
+func (it *hostIterator) Next() (string, bool) {
+	if it.idx >= len(it.ranges) {
+		return "", false
+	}
+	r := it.ranges[it.idx]
+	ip := intToAddr(it.next, r.ipv4).String()
+	if it.next.Cmp(r.last) >= 0 {
+		it.idx++
+		if it.idx < len(it.ranges) {
+			it.next = new(big.Int).Set(it.ranges[it.idx].first)
+		}
+	} else {
+		it.next = new(big.Int).Add(it.next, big.NewInt(1))
+	}
+	return ip, true
+}
@@ -0,0 +1,109 @@
+package ip_range
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+)
+
+func hosts(t *testing.T, rule *discoveryv1alpha1.IPRangeRule) []string {
+	it, err := newHostIterator(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ips []string
+	for ip, ok := it.Next(); ok; ip, ok = it.Next() {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+func TestHostIterator(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *discoveryv1alpha1.IPRangeRule
+		want []string
+	}{
+		{
+			name: "IPv4 CIDR with excludes",
+			rule: &discoveryv1alpha1.IPRangeRule{
+				CIDRs:    []string{"10.0.0.0/29"},
+				Excludes: []string{"10.0.0.0/32", "10.0.0.2-10.0.0.3", "10.0.0.7"},
+			},
+			want: []string{"10.0.0.1", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+		},
+		{
+			name: "skip network and broadcast",
+			rule: &discoveryv1alpha1.IPRangeRule{
+				CIDRs:                   []string{"10.0.0.0/30", "10.0.1.0/31", "10.0.2.1/32"},
+				SkipNetworkAndBroadcast: true,
+			},
+			want: []string{"10.0.0.1", "10.0.0.2", "10.0.1.0", "10.0.1.1", "10.0.2.1"},
+		},
+		{
+			name: "overlapping CIDRs and ranges are merged and sorted",
+			rule: &discoveryv1alpha1.IPRangeRule{
+				CIDRs:  []string{"10.0.0.4/31", "10.0.0.0/30"},
+				Ranges: []string{"10.0.0.3-10.0.0.4", "10.0.0.255 - 10.0.1.0"},
+			},
+			want: []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.255", "10.0.1.0"},
+		},
+		{
+			name: "IPv6 after IPv4",
+			rule: &discoveryv1alpha1.IPRangeRule{
+				CIDRs:                   []string{"2001:db8::/126", "192.168.0.1/32"},
+				Excludes:                []string{"2001:db8::2"},
+				SkipNetworkAndBroadcast: true,
+			},
+			want: []string{"192.168.0.1", "2001:db8::1", "2001:db8::3"},
+		},
+		{
+			name: "exclude covering the range",
+			rule: &discoveryv1alpha1.IPRangeRule{
+				CIDRs:    []string{"10.0.0.0/30"},
+				Excludes: []string{"10.0.0.0/24"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hosts(t, tt.rule); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostIteratorMaxHosts(t *testing.T) {
+	_, err := newHostIterator(&discoveryv1alpha1.IPRangeRule{
+		CIDRs:    []string{"2001:db8::/64"},
+		MaxHosts: 65536,
+	})
+	if err == nil || !strings.Contains(err.Error(), "18446744073709551616 addresses") {
+		t.Errorf("expected a maximum size error, got %v", err)
+	}
+	// excluded addresses are not counted
+	_, err = newHostIterator(&discoveryv1alpha1.IPRangeRule{
+		CIDRs:    []string{"10.0.0.0/23"},
+		Excludes: []string{"10.0.1.0/24"},
+		MaxHosts: 256,
+	})
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestHostIteratorInvalid(t *testing.T) {
+	for _, rule := range []*discoveryv1alpha1.IPRangeRule{
+		{CIDRs: []string{"10.0.0.1"}},
+		{Ranges: []string{"10.0.0.10-10.0.0.1"}},
+		{Ranges: []string{"10.0.0.1-2001:db8::1"}},
+		{Excludes: []string{"not-an-ip"}},
+	} {
+		if _, err := newHostIterator(rule); err == nil {
+			t.Errorf("expected an error for %+v", rule)
+		}
+	}
+}
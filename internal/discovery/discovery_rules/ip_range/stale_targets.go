@@ -0,0 +1,113 @@
+package ip_range
+
+import (
+	"context"
+	"net"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// handleStaleTargets updates the number of consecutive missed scans of the targets
+// created by the discovery rule and applies the stale target policy
+// to the ones that reached the stale threshold.
+// reached is the set of IP addresses that were reachable during the last run.
+func (i *ipRangeDR) handleStaleTargets(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, reached map[string]struct{}, stats *discoveryrules.RunStats) error {
+	tgList := &targetv1.TargetList{}
+	err := i.client.List(ctx, tgList,
+		client.InNamespace(discoveryrules.GetTargetNamespace(dr)),
+		client.MatchingLabels{
+			discoveryv1alpha1.LabelKeyDiscoveryRule:          dr.GetName(),
+			discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace: dr.GetNamespace(),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]struct{}, len(tgList.Items))
+	for idx := range tgList.Items {
+		tg := &tgList.Items[idx]
+		key := tg.GetNamespace() + "/" + tg.GetName()
+		existing[key] = struct{}{}
+		if _, ok := reached[targetIP(tg)]; ok {
+			delete(i.missedScans, key)
+			if _, ok := tg.GetAnnotations()[discoveryv1alpha1.AnnotationKeyStale]; ok {
+				err = i.unmarkStale(ctx, tg)
+				if err != nil {
+					i.logger.Info("failed to unmark stale target", "name", tg.GetName(), "error", err)
+				}
+			}
+			continue
+		}
+		i.missedScans[key]++
+		if i.missedScans[key] < dr.Spec.IPRange.StaleThreshold {
+			continue
+		}
+		switch dr.Spec.IPRange.StaleTargetPolicy {
+		case discoveryv1alpha1.StaleTargetPolicyDelete:
+			err = i.client.Delete(ctx, tg)
+			if err != nil {
+				i.logger.Info("failed to delete stale target", "name", tg.GetName(), "error", err)
+				continue
+			}
+			delete(i.missedScans, key)
+			stats.TargetDeleted()
+			i.logger.Info("deleted stale target", "name", tg.GetName())
+		case discoveryv1alpha1.StaleTargetPolicyMark:
+			if _, ok := tg.GetAnnotations()[discoveryv1alpha1.AnnotationKeyStale]; ok {
+				continue
+			}
+			err = i.markStale(ctx, tg)
+			if err != nil {
+				i.logger.Info("failed to mark stale target", "name", tg.GetName(), "error", err)
+				continue
+			}
+			i.logger.Info("marked stale target", "name", tg.GetName())
+		}
+	}
+	// forget about the targets that no longer exist
+	for key := range i.missedScans {
+		if _, ok := existing[key]; !ok {
+			delete(i.missedScans, key)
+		}
+	}
+	return nil
+}
+
+func (i *ipRangeDR) markStale(ctx context.Context, tg *targetv1.Target) error {
+	patch := client.MergeFrom(tg.DeepCopy())
+	anno := tg.GetAnnotations()
+	if anno == nil {
+		anno = make(map[string]string)
+	}
+	anno[discoveryv1alpha1.AnnotationKeyStale] = time.Now().UTC().Format(time.RFC3339)
+	tg.SetAnnotations(anno)
+	return i.client.Patch(ctx, tg, patch)
+}
+
+func (i *ipRangeDR) unmarkStale(ctx context.Context, tg *targetv1.Target) error {
+	patch := client.MergeFrom(tg.DeepCopy())
+	anno := tg.GetAnnotations()
+	delete(anno, discoveryv1alpha1.AnnotationKeyStale)
+	tg.SetAnnotations(anno)
+	return i.client.Patch(ctx, tg, patch)
+}
+
+// targetIP returns the IP address part of the target address
+func targetIP(tg *targetv1.Target) string {
+	if tg.Spec.Properties == nil || tg.Spec.Properties.Config == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(tg.Spec.Properties.Config.Address)
+	if err != nil {
+		host = tg.Spec.Properties.Config.Address
+	}
+	// the scanned addresses are in their canonical form
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
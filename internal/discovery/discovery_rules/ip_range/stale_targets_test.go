@@ -0,0 +1,90 @@
+package ip_range
+
+import (
+	"context"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTargetIP(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{address: "10.0.0.1:57400", want: "10.0.0.1"},
+		{address: "[2001:db8::1]:57400", want: "2001:db8::1"},
+		{address: "[2001:0db8:0000::0001]:57400", want: "2001:db8::1"},
+		{address: "10.0.0.1", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		tg := &targetv1.Target{
+			Spec: targetv1.TargetSpec{
+				Properties: &targetv1.TargetProperties{
+					Config: &targetv1.TargetConfig{Address: tt.address},
+				},
+			},
+		}
+		if got := targetIP(tg); got != tt.want {
+			t.Errorf("%s: got IP %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestHandleStaleTargets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := targetv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	newTarget := func(name, address, ruleNamespace string) *targetv1.Target {
+		return &targetv1.Target{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "targets",
+				Labels: map[string]string{
+					discoveryv1alpha1.LabelKeyDiscoveryRule:          "dr1",
+					discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace: ruleNamespace,
+				},
+			},
+			Spec: targetv1.TargetSpec{
+				Properties: &targetv1.TargetProperties{
+					Config: &targetv1.TargetConfig{Address: address},
+				},
+			},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newTarget("reached", "[2001:db8::1]:57400", "ns-a"),
+		newTarget("unreachable", "10.0.0.2:57400", "ns-a"),
+		// written in the same target namespace by a same-named rule of another namespace
+		newTarget("other-rule", "10.0.0.3:57400", "ns-b"),
+	).Build()
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "ns-a"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			TargetTemplate: &discoveryv1alpha1.TargetTemplate{Namespace: "targets"},
+			IPRange: &discoveryv1alpha1.IPRangeRule{
+				StaleTargetPolicy: discoveryv1alpha1.StaleTargetPolicyDelete,
+				StaleThreshold:    1,
+			},
+		},
+	}
+	i := &ipRangeDR{client: c, logger: logging.NewNopLogger(), missedScans: map[string]int{}}
+	reached := map[string]struct{}{"2001:db8::1": {}}
+	if err := i.handleStaleTargets(context.Background(), dr, reached, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, wantDeleted := range map[string]bool{"reached": false, "unreachable": true, "other-rule": false} {
+		err := c.Get(context.Background(), client.ObjectKey{Namespace: "targets", Name: name}, &targetv1.Target{})
+		if deleted := kerrors.IsNotFound(err); deleted != wantDeleted {
+			t.Errorf("target %s: got deleted %t, want %t (error %v)", name, deleted, wantDeleted, err)
+		}
+	}
+}
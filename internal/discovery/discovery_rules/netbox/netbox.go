@@ -0,0 +1,264 @@
+package netbox
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	discoveryrules "github.com/yndd/discovery/internal/discovery/discovery_rules"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	devicesPath        = "/api/dcim/devices/"
+	defaultPageSize    = 100
+	defaultHTTPTimeout = 30 * time.Second
+
+	tokenSecretKey = "token"
+
+	LabelKeyNetBoxDeviceID = "netbox.yndd.io/device-id"
+	LabelKeyNetBoxSite     = "netbox.yndd.io/site"
+	LabelKeyNetBoxRole     = "netbox.yndd.io/role"
+)
+
+func init() {
+	discoveryrules.Register(discoveryrules.NetBoxDiscoveryRule, func() discoveryrules.DiscoveryRule {
+		return &netBoxDR{}
+	})
+}
+
+type netBoxDR struct {
+	client  client.Client
+	logger  logging.Logger
+	cfn     context.CancelFunc
+	trigger <-chan string
+}
+
+func (n *netBoxDR) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, opts ...discoveryrules.Option) error {
+	ctx, n.cfn = context.WithCancel(ctx)
+	for _, o := range opts {
+		o(n)
+	}
+	n.logger = n.logger.WithValues("discovery-rule", fmt.Sprintf("%s/%s", dr.GetNamespace(), dr.GetName()))
+	return discoveryrules.RunPeriodically(ctx, n.client, dr, n.logger, n.trigger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+		return n.run(ctx, dr, stats)
+	})
+}
+
+func (n *netBoxDR) Stop() error {
+	n.cfn()
+	return nil
+}
+
+func (n *netBoxDR) SetLogger(logger logging.Logger) {
+	n.logger = logger
+}
+
+func (n *netBoxDR) SetClient(c client.Client) {
+	n.client = c
+}
+
+func (n *netBoxDR) SetTrigger(trigger <-chan string) {
+	n.trigger = trigger
+}
+
+func (n *netBoxDR) run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, stats *discoveryrules.RunStats) error {
+	token, err := n.getToken(ctx, dr)
+	if err != nil {
+		return err
+	}
+	devices, err := listDevices(ctx, dr.Spec.NetBoxRule, token)
+	if err != nil {
+		return err
+	}
+	n.logger.Debug("netbox returned devices", "count", len(devices))
+	for _, d := range devices {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		ip := d.primaryIP()
+		if ip == "" {
+			n.logger.Debug("device has no primary IP", "device", d.Name)
+			continue
+		}
+		err = discoveryrules.Discover(ctx, n.client, dr, ip, d.labels(), stats, n.logger)
+		if err != nil {
+			n.logger.Info("Failed discovery", "device", d.Name, "IP", ip, "error", err)
+		}
+	}
+	return nil
+}
+
+func (n *netBoxDR) getToken(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) (string, error) {
+	if dr.Spec.NetBoxRule.TokenSecret == "" {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	err := n.client.Get(ctx, types.NamespacedName{
+		Namespace: dr.GetNamespace(),
+		Name:      dr.Spec.NetBoxRule.TokenSecret,
+	}, secret)
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Data[tokenSecretKey]), nil
+}
+
+type deviceList struct {
+	Count   int       `json:"count,omitempty"`
+	Next    *string   `json:"next,omitempty"`
+	Results []*device `json:"results,omitempty"`
+}
+
+type device struct {
+	ID         int        `json:"id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Site       *nestedObj `json:"site,omitempty"`
+	DeviceRole *nestedObj `json:"device_role,omitempty"`
+	// NetBox >= 3.6 exposes the device role as role
+	Role      *nestedObj `json:"role,omitempty"`
+	PrimaryIP *ipAddress `json:"primary_ip,omitempty"`
+}
+
+type nestedObj struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Slug string `json:"slug,omitempty"`
+}
+
+type ipAddress struct {
+	ID      int    `json:"id,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// primaryIP returns the device primary IP address without its prefix length
+func (d *device) primaryIP() string {
+	if d.PrimaryIP == nil || d.PrimaryIP.Address == "" {
+		return ""
+	}
+	ip, _, err := net.ParseCIDR(d.PrimaryIP.Address)
+	if err != nil {
+		return d.PrimaryIP.Address
+	}
+	return ip.String()
+}
+
+func (d *device) labels() map[string]string {
+	labels := map[string]string{
+		LabelKeyNetBoxDeviceID: strconv.Itoa(d.ID),
+	}
+	if d.Site != nil {
+		labels[LabelKeyNetBoxSite] = d.Site.Slug
+	}
+	switch {
+	case d.Role != nil:
+		labels[LabelKeyNetBoxRole] = d.Role.Slug
+	case d.DeviceRole != nil:
+		labels[LabelKeyNetBoxRole] = d.DeviceRole.Slug
+	}
+	return labels
+}
+
+// listDevices pages through the NetBox devices endpoint and
+// returns the devices matching the rule filters.
+func listDevices(ctx context.Context, r *discoveryv1alpha1.NetBoxRule, token string) ([]*device, error) {
+	u, err := devicesURL(r)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Timeout: defaultHTTPTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: r.Insecure,
+			},
+		},
+	}
+	devices := make([]*device, 0)
+	next := u
+	for next != "" {
+		dl, err := getDevices(ctx, httpClient, next, token)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, dl.Results...)
+		next = ""
+		if dl.Next != nil {
+			next = *dl.Next
+		}
+	}
+	return devices, nil
+}
+
+func devicesURL(r *discoveryv1alpha1.NetBoxRule) (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + devicesPath
+	pageSize := r.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(pageSize))
+	q.Set("has_primary_ip", "true")
+	for _, s := range r.Sites {
+		q.Add("site", s)
+	}
+	for _, s := range r.Roles {
+		q.Add("role", s)
+	}
+	for _, s := range r.Tags {
+		q.Add("tag", s)
+	}
+	for _, s := range r.Platforms {
+		q.Add("platform", s)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func getDevices(ctx context.Context, httpClient *http.Client, u, token string) (*deviceList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("netbox request failed: %s: %s", rsp.Status, string(b))
+	}
+	dl := new(deviceList)
+	err = json.Unmarshal(b, dl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode netbox response: %w", err)
+	}
+	return dl, nil
+}
@@ -0,0 +1,130 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+)
+
+func TestListDevices(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != devicesPath {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		if !reflect.DeepEqual(q["site"], []string{"dc1"}) || !reflect.DeepEqual(q["role"], []string{"leaf", "spine"}) {
+			t.Errorf("unexpected filters: %v", q)
+		}
+		var rsp map[string]interface{}
+		switch q.Get("offset") {
+		case "":
+			rsp = map[string]interface{}{
+				"count": 3,
+				"next":  fmt.Sprintf("%s%s?offset=2&site=dc1&role=leaf&role=spine", srv.URL, devicesPath),
+				"results": []interface{}{
+					map[string]interface{}{
+						"id": 1, "name": "leaf1",
+						"site":       map[string]interface{}{"id": 1, "slug": "dc1"},
+						"role":       map[string]interface{}{"id": 1, "slug": "leaf"},
+						"primary_ip": map[string]interface{}{"id": 10, "address": "10.0.0.1/24"},
+					},
+					map[string]interface{}{
+						"id": 2, "name": "leaf2",
+						"site":        map[string]interface{}{"id": 1, "slug": "dc1"},
+						"device_role": map[string]interface{}{"id": 1, "slug": "leaf"},
+						"primary_ip":  map[string]interface{}{"id": 11, "address": "2001:db8::2/64"},
+					},
+				},
+			}
+		case "2":
+			rsp = map[string]interface{}{
+				"count": 3,
+				"next":  nil,
+				"results": []interface{}{
+					map[string]interface{}{
+						"id": 3, "name": "spine1",
+						"site": map[string]interface{}{"id": 1, "slug": "dc1"},
+						"role": map[string]interface{}{"id": 2, "slug": "spine"},
+					},
+				},
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	defer srv.Close()
+
+	devices, err := listDevices(context.Background(), &discoveryv1alpha1.NetBoxRule{
+		URL:   srv.URL,
+		Sites: []string{"dc1"},
+		Roles: []string{"leaf", "spine"},
+	}, "secret-token")
+	if err != nil {
+		t.Fatalf("listDevices failed: %v", err)
+	}
+	if len(devices) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(devices))
+	}
+
+	tests := []struct {
+		ip     string
+		labels map[string]string
+	}{
+		{
+			ip: "10.0.0.1",
+			labels: map[string]string{
+				LabelKeyNetBoxDeviceID: "1",
+				LabelKeyNetBoxSite:     "dc1",
+				LabelKeyNetBoxRole:     "leaf",
+			},
+		},
+		{
+			ip: "2001:db8::2",
+			labels: map[string]string{
+				LabelKeyNetBoxDeviceID: "2",
+				LabelKeyNetBoxSite:     "dc1",
+				LabelKeyNetBoxRole:     "leaf",
+			},
+		},
+		{
+			ip: "",
+			labels: map[string]string{
+				LabelKeyNetBoxDeviceID: "3",
+				LabelKeyNetBoxSite:     "dc1",
+				LabelKeyNetBoxRole:     "spine",
+			},
+		},
+	}
+	for i, tt := range tests {
+		if got := devices[i].primaryIP(); got != tt.ip {
+			t.Errorf("device %d: expected primary IP %q, got %q", i, tt.ip, got)
+		}
+		if got := devices[i].labels(); !reflect.DeepEqual(got, tt.labels) {
+			t.Errorf("device %d: expected labels %v, got %v", i, tt.labels, got)
+		}
+	}
+}
+
+func TestListDevicesError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := listDevices(context.Background(), &discoveryv1alpha1.NetBoxRule{URL: srv.URL}, "")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,101 @@
+package discovery_rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	"github.com/yndd/discovery/internal/discovery/netconf"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultNetconfTimeout = 5 * time.Second
+
+// ErrUnsupportedNetconfDevice is returned when the NETCONF server is not a Nokia SR OS device,
+// the only one with a NETCONF discoverer.
+var ErrUnsupportedNetconfDevice = fmt.Errorf("%w: unsupported netconf device, only Nokia SR OS is supported", ErrUnknownVendor)
+
+// GetDiscovererNetconf selects the NETCONF discoverer from the capabilities
+// the server advertised in its hello message, only Nokia SR OS is supported.
+func GetDiscovererNetconf(capabilities []string) (discoverers.NetconfDiscoverer, error) {
+	for _, c := range capabilities {
+		switch {
+		case strings.Contains(c, "urn:nokia.com:sros:ns:yang:sr"):
+			init := discoverers.NetconfDiscoverers[discoverers.NokiaSROSDiscovererName]
+			return init(), nil
+		}
+	}
+	return nil, ErrUnsupportedNetconfDevice
+}
+
+// CreateNetconfSession opens a NETCONF session to ip using the credentials stored in creds.
+func CreateNetconfSession(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, creds *corev1.Secret, ip string) (*netconf.Session, error) {
+	username, password := string(creds.Data[usernameKey]), string(creds.Data[passwordKey])
+	cfg := &ssh.ClientConfig{
+		User: username,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		},
+		// host keys of devices being discovered are not known in advance
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         defaultNetconfTimeout,
+	}
+	return netconf.Dial(ctx, targetAddress(ip, targetPort(dr)), cfg)
+}
+
+func discoverNetconf(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *RunStats, logger logging.Logger) error {
+	logger.Info("Creating NETCONF session", "IP", ip)
+	var reachable bool
+	di, credentials, err := tryCredentials(ctx, c, dr, ip, logger, func(creds *corev1.Secret) (*targetv1.DiscoveryInfo, error) {
+		s, err := CreateNetconfSession(ctx, dr, creds, ip)
+		if err != nil {
+			if isAuthError(err) {
+				reachable = true
+				return nil, fmt.Errorf("%w: %v", errCredentialsRejected, err)
+			}
+			return nil, fmt.Errorf("%w: failed to create NETCONF session: %v", ErrHostUnreachable, err)
+		}
+		defer s.Close()
+		reachable = true
+		discoverer, err := GetDiscovererNetconf(s.ServerCapabilities())
+		if err != nil {
+			return nil, err
+		}
+		return discoverer.DiscoverNetconf(ctx, dr, s)
+	})
+	if reachable {
+		stats.HostReachable()
+	}
+	if err != nil {
+		return err
+	}
+	stats.HostDiscovered()
+	b, _ := json.Marshal(di)
+	logger.Info("discovery info", "info", string(b))
+	tc := &targetv1.TargetConfig{
+		Address:        targetAddress(ip, targetPort(dr)),
+		CredentialName: credentials,
+		Protocol:       targetv1.Protocol(targetv1.Protocol_NETCONF),
+	}
+	op, err := ApplyTarget(ctx, c, dr, di, tc, drLabels)
+	if err != nil {
+		return err
+	}
+	stats.TargetApplied(op)
+	return nil
+}
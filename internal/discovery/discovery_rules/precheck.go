@@ -0,0 +1,163 @@
+package discovery_rules
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+)
+
+const (
+	defaultPreCheckTimeout = time.Second
+
+	icmpTypeEcho          = 8
+	icmpTypeEchoReply     = 0
+	icmpv6TypeEchoRequest = 128
+	icmpv6TypeEchoReply   = 129
+)
+
+var echoData = []byte("yndd-discovery")
+
+// PreChecker filters the live hosts before their discovery
+type PreChecker struct {
+	// TCP port checked, 0 disables the TCP check
+	port    uint
+	timeout time.Duration
+	icmp    bool
+	logger  logging.Logger
+	// logs once that ICMP sockets are not permitted
+	icmpErrOnce sync.Once
+}
+
+// NewPreChecker returns the pre-checker of the discovery rule configured by cfg,
+// nil if no check applies.
+func NewPreChecker(dr *discoveryv1alpha1.DiscoveryRule, cfg *discoveryv1alpha1.PreCheck, logger logging.Logger) *PreChecker {
+	if cfg == nil {
+		cfg = &discoveryv1alpha1.PreCheck{}
+	}
+	if cfg.Disabled {
+		return nil
+	}
+	p := &PreChecker{
+		timeout: defaultPreCheckTimeout,
+		icmp:    cfg.ICMP,
+		logger:  logger,
+	}
+	if cfg.Timeout != nil && cfg.Timeout.Duration > 0 {
+		p.timeout = cfg.Timeout.Duration
+	}
+	// SNMP runs over UDP, there is no TCP port to check
+	if dr.Spec.Protocol != "snmp" {
+		p.port = targetPort(dr)
+	}
+	if p.port == 0 && !p.icmp {
+		return nil
+	}
+	return p
+}
+
+// Reachable reports whether ip accepts a TCP connection on the discovery port
+// or, if enabled, answers an ICMP echo request.
+func (p *PreChecker) Reachable(ctx context.Context, ip string) bool {
+	if p.port != 0 && p.dialTCP(ctx, ip) {
+		return true
+	}
+	if p.icmp {
+		ok, err := ping(ctx, net.ParseIP(ip), p.timeout)
+		if err == nil {
+			return ok
+		}
+		p.icmpErrOnce.Do(func() {
+			p.logger.Info("ICMP pre-check not available", "error", err)
+		})
+		// without the TCP check the host cannot be judged
+		return p.port == 0
+	}
+	return false
+}
+
+func (p *PreChecker) dialTCP(ctx context.Context, ip string) bool {
+	d := net.Dialer{Timeout: p.timeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(int(p.port))))
+	if err != nil {
+		p.logger.Debug("TCP pre-check failed", "IP", ip, "error", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// ping sends an ICMP echo request to ip over a raw socket
+// and waits for the reply until the timeout expires.
+// An error is returned if the socket cannot be opened.
+func ping(ctx context.Context, ip net.IP, timeout time.Duration) (bool, error) {
+	if ip == nil {
+		return false, nil
+	}
+	// the kernel overwrites the checksum of ICMPv6 messages, which covers the IPv6 pseudo-header
+	network, typ, replyTyp := "ip4:icmp", byte(icmpTypeEcho), byte(icmpTypeEchoReply)
+	if ip.To4() == nil {
+		network, typ, replyTyp = "ip6:ipv6-icmp", icmpv6TypeEchoRequest, icmpv6TypeEchoReply
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return false, err
+	}
+	id := uint16(os.Getpid())
+	_, err = conn.WriteTo(echoRequest(typ, id), &net.IPAddr{IP: ip})
+	if err != nil {
+		return false, nil
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			// deadline exceeded
+			return false, nil
+		}
+		// type, code, checksum, identifier
+		if n < 8 || buf[0] != replyTyp || binary.BigEndian.Uint16(buf[4:6]) != id {
+			continue
+		}
+		if addr, ok := peer.(*net.IPAddr); ok && addr.IP.Equal(ip) {
+			return true, nil
+		}
+	}
+}
+
+// echoRequest returns an ICMP echo request message with the checksum set
+func echoRequest(typ byte, id uint16) []byte {
+	b := make([]byte, 8, 8+len(echoData))
+	b[0] = typ
+	binary.BigEndian.PutUint16(b[4:6], id)
+	binary.BigEndian.PutUint16(b[6:8], 1)
+	b = append(b, echoData...)
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	binary.BigEndian.PutUint16(b[2:4], ^uint16(sum))
+	return b
+}
@@ -0,0 +1,61 @@
+package discovery_rules
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreCheckTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := uint(l.Addr().(*net.TCPAddr).Port)
+
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			Protocol: "gnmi",
+			Port:     port,
+		},
+	}
+	pc := NewPreChecker(dr, &discoveryv1alpha1.PreCheck{Timeout: &metav1.Duration{Duration: 500 * time.Millisecond}}, logging.NewNopLogger())
+	if pc == nil {
+		t.Fatal("expected a pre-checker")
+	}
+	if !pc.Reachable(context.Background(), "127.0.0.1") {
+		t.Error("expected the listening host to be reachable")
+	}
+	l.Close()
+	if pc.Reachable(context.Background(), "127.0.0.1") {
+		t.Error("expected the host without listener to be unreachable")
+	}
+}
+
+func TestNewPreCheckerDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		preCheck *discoveryv1alpha1.PreCheck
+	}{
+		{name: "disabled", protocol: "gnmi", preCheck: &discoveryv1alpha1.PreCheck{Disabled: true}},
+		{name: "snmp without ICMP", protocol: "snmp"},
+	}
+	for _, tt := range tests {
+		dr := &discoveryv1alpha1.DiscoveryRule{
+			Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+				Protocol: tt.protocol,
+				Port:     57400,
+			},
+		}
+		if pc := NewPreChecker(dr, tt.preCheck, logging.NewNopLogger()); pc != nil {
+			t.Errorf("%s: expected no pre-checker", tt.name)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package discovery_rules
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maximum number of blackout windows a run time is pushed out of,
+// bounds the search when the windows overlap continuously
+const maxBlackoutSkips = 100
+
+// schedule computes the run times of a discovery rule
+type schedule struct {
+	// cron schedule, nil when the rule runs every period
+	cron      cron.Schedule
+	period    time.Duration
+	jitter    time.Duration
+	blackouts []blackoutWindow
+	rnd       *rand.Rand
+}
+
+type blackoutWindow struct {
+	start    cron.Schedule
+	duration time.Duration
+}
+
+func newSchedule(dr *discoveryv1alpha1.DiscoveryRule) (*schedule, error) {
+	s := &schedule{
+		period: dr.Spec.Period.Duration,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if dr.Spec.Jitter != nil {
+		s.jitter = dr.Spec.Jitter.Duration
+	}
+	var err error
+	if dr.Spec.Schedule != "" {
+		s.cron, err = cron.ParseStandard(dr.Spec.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", dr.Spec.Schedule, err)
+		}
+	}
+	for _, w := range dr.Spec.BlackoutWindows {
+		start, err := cron.ParseStandard(w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window start %q: %w", w.Start, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return nil, fmt.Errorf("blackout window %q has no duration", w.Start)
+		}
+		s.blackouts = append(s.blackouts, blackoutWindow{start: start, duration: w.Duration.Duration})
+	}
+	return s, nil
+}
+
+// ValidateSchedule checks the cron schedule and the blackout windows of the discovery rule.
+func ValidateSchedule(dr *discoveryv1alpha1.DiscoveryRule) error {
+	_, err := newSchedule(dr)
+	return err
+}
+
+// first returns the time of the first run when the rule starts at now:
+// immediately with a period, at the next scheduled time with a cron schedule.
+func (s *schedule) first(now time.Time) time.Time {
+	if s.cron != nil {
+		return s.skipBlackouts(s.cron.Next(now))
+	}
+	return s.skipBlackouts(now)
+}
+
+// next returns the time of the run following a run that ended at t,
+// the zero time if the cron schedule never fires again.
+func (s *schedule) next(t time.Time) time.Time {
+	var n time.Time
+	if s.cron != nil {
+		n = s.cron.Next(t)
+	} else {
+		n = t.Add(s.period)
+	}
+	if n.IsZero() {
+		return n
+	}
+	if s.jitter > 0 {
+		n = n.Add(time.Duration(s.rnd.Int63n(int64(s.jitter))))
+	}
+	return s.skipBlackouts(n)
+}
+
+// skipBlackouts moves t to the end of the blackout windows it falls in.
+func (s *schedule) skipBlackouts(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	for n := 0; n < maxBlackoutSkips; n++ {
+		moved := false
+		for _, w := range s.blackouts {
+			// first window opening after t-duration, open at t if it is not after t
+			start := w.start.Next(t.Add(-w.duration))
+			if !start.IsZero() && !start.After(t) {
+				t = start.Add(w.duration)
+				moved = true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return t
+}
+
+// nextBlackout returns the first blackout window opening after t, the zero time if there is none.
+func (s *schedule) nextBlackout(t time.Time) time.Time {
+	var next time.Time
+	for _, w := range s.blackouts {
+		start := w.start.Next(t)
+		if !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
+
+// RunPeriodically runs the discovery rule and reports each run in its status until ctx is done.
+// Runs follow the rule cron schedule or its period plus a random jitter, outside of its blackout windows.
+// They are aborted when the rule run timeout expires or a blackout window opens.
+// A value received on trigger starts a run immediately, even in a blackout window.
+func RunPeriodically(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, logger logging.Logger, trigger <-chan string, run func(ctx context.Context, stats *RunStats) error) error {
+	s, err := newSchedule(dr)
+	if err != nil {
+		return err
+	}
+	next := s.first(time.Now())
+	for {
+		err = SetNextRunTime(ctx, c, dr, next)
+		if err != nil {
+			logger.Info("failed to update discovery rule status", "error", err)
+		}
+		if next.IsZero() {
+			logger.Info("discovery rule schedule has no next run", "schedule", dr.Spec.Schedule)
+		} else {
+			logger.Debug("waiting for next run", "name", dr.GetName(), "time", next)
+		}
+		runNow, err := wait(ctx, next, trigger)
+		if err != nil {
+			return err
+		}
+		// a run requested while waiting or running is handled by this run
+		select {
+		case runNow = <-trigger:
+		default:
+		}
+		if runNow != "" {
+			logger.Info("run now requested", "trigger", runNow)
+			err = SetRunNowHandled(ctx, c, dr, runNow)
+			if err != nil {
+				logger.Info("failed to update discovery rule status", "error", err)
+			}
+		}
+		RunAndReport(ctx, c, dr, logger, func(ctx context.Context, stats *RunStats) error {
+			deadline := s.nextBlackout(time.Now())
+			if dr.Spec.RunTimeout != nil && dr.Spec.RunTimeout.Duration > 0 {
+				timeout := time.Now().Add(dr.Spec.RunTimeout.Duration)
+				if deadline.IsZero() || timeout.Before(deadline) {
+					deadline = timeout
+				}
+			}
+			if !deadline.IsZero() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+			return run(ctx, stats)
+		})
+		next = s.next(time.Now())
+	}
+}
+
+// wait waits until t, forever if t is zero, or until a run now request is received on trigger,
+// in which case the request is returned. It returns early with the context error if ctx is done.
+func wait(ctx context.Context, t time.Time, trigger <-chan string) (string, error) {
+	var timeout <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-timeout:
+		return "", nil
+	case runNow := <-trigger:
+		return runNow, nil
+	}
+}
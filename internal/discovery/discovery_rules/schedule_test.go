@@ -0,0 +1,104 @@
+package discovery_rules
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScheduleJitter(t *testing.T) {
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			Period: metav1.Duration{Duration: time.Minute},
+		},
+	}
+	now := time.Now()
+	s, err := newSchedule(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.next(now); !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("got next run %s without jitter, want %s", got, now.Add(time.Minute))
+	}
+	dr.Spec.Jitter = &metav1.Duration{Duration: 10 * time.Second}
+	s, err = newSchedule(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 100; n++ {
+		d := s.next(now).Sub(now)
+		if d < time.Minute || d >= time.Minute+10*time.Second {
+			t.Fatalf("got delay %s out of the jitter bounds", d)
+		}
+	}
+}
+
+func TestScheduleCronAndBlackouts(t *testing.T) {
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			Period:   metav1.Duration{Duration: time.Minute},
+			Schedule: "CRON_TZ=UTC 0 * * * *",
+			BlackoutWindows: []discoveryv1alpha1.BlackoutWindow{
+				// 22:00 to 02:00, overlapping the next window
+				{Start: "CRON_TZ=UTC 0 22 * * *", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+				{Start: "CRON_TZ=UTC 30 1 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+		},
+	}
+	s, err := newSchedule(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h, m int) time.Time {
+		return time.Date(2022, 6, 1, h, m, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{name: "first scheduled run", got: s.first(at(10, 15)), want: at(11, 0)},
+		{name: "next scheduled run", got: s.next(at(11, 5)), want: at(12, 0)},
+		{name: "run pushed out of the blackout windows", got: s.next(at(21, 30)), want: at(26, 30)},
+		{name: "next blackout window", got: s.nextBlackout(at(12, 0)), want: at(22, 0)},
+	}
+	for _, tt := range tests {
+		if !tt.got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+
+	dr.Spec.Schedule = "not a schedule"
+	if err := ValidateSchedule(dr); err == nil {
+		t.Error("expected an error on an invalid schedule")
+	}
+	dr.Spec.Schedule = ""
+	dr.Spec.BlackoutWindows = []discoveryv1alpha1.BlackoutWindow{{Start: "@daily"}}
+	if err := ValidateSchedule(dr); err == nil {
+		t.Error("expected an error on a blackout window without duration")
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err := wait(ctx, start.Add(time.Hour), nil); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("wait did not return on cancellation")
+	}
+	if runNow, err := wait(context.Background(), time.Now().Add(time.Millisecond), nil); err != nil || runNow != "" {
+		t.Errorf("unexpected run now %q, error %v", runNow, err)
+	}
+	trigger := make(chan string, 1)
+	trigger <- "2022-06-01T10:00:00Z"
+	runNow, err := wait(context.Background(), time.Time{}, trigger)
+	if err != nil || runNow != "2022-06-01T10:00:00Z" {
+		t.Errorf("unexpected run now %q, error %v", runNow, err)
+	}
+}
@@ -0,0 +1,183 @@
+package discovery_rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/snmp"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultSNMPPort    = 161
+	defaultSNMPTimeout = 5 * time.Second
+
+	// credentials secret keys
+	snmpCommunityKey      = "community"
+	snmpUsernameKey       = "username"
+	snmpAuthPassphraseKey = "authPassphrase"
+	snmpPrivPassphraseKey = "privPassphrase"
+)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// CreateSNMPClient returns an SNMP client connected to ip,
+// configured from the discovery rule SNMP parameters and the credentials stored in creds.
+func CreateSNMPClient(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, creds *corev1.Secret, ip string) (*gosnmp.GoSNMP, error) {
+	cfg := dr.Spec.SNMP
+	if cfg == nil {
+		cfg = &discoveryv1alpha1.SNMPConfig{}
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = defaultSNMPPort
+	}
+	g := &gosnmp.GoSNMP{
+		Target:  ip,
+		Port:    uint16(port),
+		Context: ctx,
+		Timeout: defaultSNMPTimeout,
+		Retries: 1,
+		MaxOids: gosnmp.MaxOids,
+	}
+	switch cfg.Version {
+	case "v3":
+		usm := &gosnmp.UsmSecurityParameters{
+			UserName: string(creds.Data[snmpUsernameKey]),
+		}
+		switch cfg.SecurityLevel {
+		case "noAuthNoPriv":
+			g.MsgFlags = gosnmp.NoAuthNoPriv
+		case "authNoPriv":
+			g.MsgFlags = gosnmp.AuthNoPriv
+		default:
+			g.MsgFlags = gosnmp.AuthPriv
+		}
+		if g.MsgFlags&gosnmp.AuthNoPriv != 0 {
+			usm.AuthenticationProtocol = gosnmp.SHA
+			if p, ok := snmpAuthProtocols[cfg.AuthProtocol]; ok {
+				usm.AuthenticationProtocol = p
+			}
+			usm.AuthenticationPassphrase = string(creds.Data[snmpAuthPassphraseKey])
+		}
+		if g.MsgFlags&gosnmp.AuthPriv == gosnmp.AuthPriv {
+			usm.PrivacyProtocol = gosnmp.AES
+			if p, ok := snmpPrivProtocols[cfg.PrivProtocol]; ok {
+				usm.PrivacyProtocol = p
+			}
+			usm.PrivacyPassphrase = string(creds.Data[snmpPrivPassphraseKey])
+		}
+		g.Version = gosnmp.Version3
+		g.SecurityModel = gosnmp.UserSecurityModel
+		g.SecurityParameters = usm
+	default: // v2c
+		community, ok := creds.Data[snmpCommunityKey]
+		if !ok {
+			return nil, errors.New("credentials secret has no SNMP community")
+		}
+		g.Version = gosnmp.Version2c
+		g.Community = string(community)
+	}
+	err := g.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHostUnreachable, err)
+	}
+	return g, nil
+}
+
+func discoverSNMP(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, ip string, drLabels map[string]string, stats *RunStats, logger logging.Logger) error {
+	logger.Info("Creating SNMP client", "IP", ip)
+	discover := func(creds *corev1.Secret) (*targetv1.DiscoveryInfo, error) {
+		g, err := CreateSNMPClient(ctx, dr, creds, ip)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SNMP client: %w", err)
+		}
+		defer g.Conn.Close()
+		di, err := snmp.Discover(g)
+		if err != nil {
+			return nil, snmpError(err)
+		}
+		return di, nil
+	}
+	var di *targetv1.DiscoveryInfo
+	var credentials string
+	var err error
+	if dr.Spec.SNMP != nil && dr.Spec.SNMP.Credentials != "" {
+		var creds *corev1.Secret
+		creds, err = getCredentialsSecret(ctx, c, dr.GetNamespace(), dr.Spec.SNMP.Credentials)
+		if err != nil {
+			return err
+		}
+		di, err = discover(creds)
+		if err == nil {
+			credentials, err = targetCredentials(dr, ip, di.VendorType)
+		}
+	} else {
+		di, credentials, err = tryCredentials(ctx, c, dr, ip, logger, discover)
+	}
+	if err != nil {
+		return err
+	}
+	stats.HostReachable()
+	stats.HostDiscovered()
+	b, _ := json.Marshal(di)
+	logger.Info("discovery info", "info", string(b))
+	// SNMP is only used to discover the device,
+	// the target is set up to be managed using gNMI with the gNMI credentials
+	tc := &targetv1.TargetConfig{
+		Address:           targetAddress(ip, targetPort(dr)),
+		CredentialName:    credentials,
+		TlsCredentialName: tlsCredentialName(dr),
+		Insecure:          dr.Spec.Insecure,
+		Protocol:          targetv1.Protocol(targetv1.Protocol_GNMI),
+		SkipVerify:        !dr.Spec.Insecure && dr.Spec.Certificate == "",
+	}
+	op, err := ApplyTarget(ctx, c, dr, di, tc, drLabels)
+	if err != nil {
+		return err
+	}
+	stats.TargetApplied(op)
+	return nil
+}
+
+// snmpError classifies an SNMP discovery error. The credentials are only rejected on a positive
+// signal: the USM reports of an SNMPv3 agent or an authorizationError response. An agent not
+// responding is unreachable, even though SNMPv2c agents drop the requests with an unknown community.
+func snmpError(err error) error {
+	switch {
+	case errors.Is(err, gosnmp.ErrUnknownUsername),
+		errors.Is(err, gosnmp.ErrWrongDigest),
+		errors.Is(err, gosnmp.ErrDecryption),
+		errors.Is(err, gosnmp.ErrUnknownSecurityLevel),
+		errors.Is(err, snmp.ErrAuthorization):
+		return fmt.Errorf("%w: %v", errCredentialsRejected, err)
+	case errors.Is(err, snmp.ErrNoResponse):
+		return fmt.Errorf("%w: %v", ErrHostUnreachable, err)
+	default:
+		return fmt.Errorf("failed SNMP discovery: %w", err)
+	}
+}
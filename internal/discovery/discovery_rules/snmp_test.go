@@ -0,0 +1,34 @@
+package discovery_rules
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/yndd/discovery/internal/discovery/snmp"
+)
+
+func TestSNMPError(t *testing.T) {
+	noResponse := fmt.Errorf("%w: request timeout (after 1 retries)", snmp.ErrNoResponse)
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "unknown user", err: gosnmp.ErrUnknownUsername, want: errCredentialsRejected},
+		{name: "wrong digest", err: gosnmp.ErrWrongDigest, want: errCredentialsRejected},
+		{name: "authorization error", err: fmt.Errorf("%w: AuthorizationError", snmp.ErrAuthorization), want: errCredentialsRejected},
+		{name: "no response", err: noResponse, want: ErrHostUnreachable},
+	}
+	for _, tt := range tests {
+		err := snmpError(tt.err)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	err := snmpError(errors.New("agent did not return sysObjectID"))
+	if errors.Is(err, errCredentialsRejected) || errors.Is(err, ErrHostUnreachable) {
+		t.Errorf("discovery failure classified as %v", err)
+	}
+}
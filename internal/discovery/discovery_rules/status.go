@@ -0,0 +1,229 @@
+package discovery_rules
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers/profile_discoverer"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// maximum number of per-host errors kept in the run status
+	maxHostErrors = 10
+	// timeout of the status update reporting the end of a run
+	runFinishedTimeout = 10 * time.Second
+)
+
+// RunStats collects the results of a discovery rule run,
+// its methods are safe for concurrent use and can be called on a nil *RunStats.
+type RunStats struct {
+	m      *sync.Mutex
+	status *discoveryv1alpha1.RunStatus
+}
+
+func NewRunStats() *RunStats {
+	return &RunStats{
+		m: new(sync.Mutex),
+		status: &discoveryv1alpha1.RunStatus{
+			StartTime: &metav1.Time{Time: time.Now()},
+		},
+	}
+}
+
+func (s *RunStats) update(fn func(rs *discoveryv1alpha1.RunStatus)) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	fn(s.status)
+}
+
+func (s *RunStats) HostScanned() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.HostsScanned++ })
+}
+
+func (s *RunStats) HostReachable() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.HostsReachable++ })
+}
+
+func (s *RunStats) HostDiscovered() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.HostsDiscovered++ })
+}
+
+// HostUnreachable records a host skipped by the reachability pre-check
+// or not answering the discovery protocol.
+func (s *RunStats) HostUnreachable() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.HostsUnreachable++ })
+}
+
+func (s *RunStats) HostAuthFailed() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.HostsAuthFailed++ })
+}
+
+func (s *RunStats) HostUnknownVendor() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.HostsUnknownVendor++ })
+}
+
+// HostFailed records a failed host discovery, only the last maxHostErrors errors are kept.
+func (s *RunStats) HostFailed(host string, err error) {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) {
+		rs.HostsFailed++
+		rs.Errors = append(rs.Errors, discoveryv1alpha1.HostError{
+			Host:  host,
+			Error: err.Error(),
+			Time:  metav1.Now(),
+		})
+		if len(rs.Errors) > maxHostErrors {
+			rs.Errors = rs.Errors[len(rs.Errors)-maxHostErrors:]
+		}
+	})
+}
+
+// TargetApplied records the result of an ApplyTarget call.
+func (s *RunStats) TargetApplied(op controllerutil.OperationResult) {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) {
+		switch op {
+		case controllerutil.OperationResultCreated:
+			rs.TargetsCreated++
+		case controllerutil.OperationResultUpdated:
+			rs.TargetsUpdated++
+		}
+	})
+}
+
+// TargetConflict records a target not applied because of a field manager conflict.
+func (s *RunStats) TargetConflict() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.TargetsConflicting++ })
+}
+
+func (s *RunStats) TargetDeleted() {
+	s.update(func(rs *discoveryv1alpha1.RunStatus) { rs.TargetsDeleted++ })
+}
+
+// RunStatus returns a copy of the collected run status with its end time and duration set.
+func (s *RunStats) RunStatus() *discoveryv1alpha1.RunStatus {
+	if s == nil {
+		return nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	rs := s.status.DeepCopy()
+	now := time.Now()
+	rs.EndTime = &metav1.Time{Time: now}
+	rs.Duration = metav1.Duration{Duration: now.Sub(rs.StartTime.Time)}
+	return rs
+}
+
+// UpdateStatus applies fn to the latest version of the discovery rule status
+// and writes it back through the status subresource, retrying on conflicts.
+func UpdateStatus(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, fn func(status *discoveryv1alpha1.DiscoveryRuleStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &discoveryv1alpha1.DiscoveryRule{}
+		err := c.Get(ctx, client.ObjectKeyFromObject(dr), latest)
+		if err != nil {
+			return err
+		}
+		fn(&latest.Status)
+		return c.Status().Update(ctx, latest)
+	})
+}
+
+// SetRunStarted sets the Running condition of the discovery rule.
+func SetRunStarted(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule) error {
+	return UpdateStatus(ctx, c, dr, func(status *discoveryv1alpha1.DiscoveryRuleStatus) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               discoveryv1alpha1.ConditionTypeRunning,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: dr.GetGeneration(),
+			Reason:             "RunStarted",
+			Message:            "discovery rule run in progress",
+		})
+	})
+}
+
+// SetNextRunTime writes the time of the next scheduled run of the discovery rule,
+// a zero next time clears it.
+func SetNextRunTime(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, next time.Time) error {
+	return UpdateStatus(ctx, c, dr, func(status *discoveryv1alpha1.DiscoveryRuleStatus) {
+		status.NextRunTime = nil
+		if !next.IsZero() {
+			status.NextRunTime = &metav1.Time{Time: next}
+		}
+	})
+}
+
+// SetRunNowHandled records the run now annotation value that started a run.
+func SetRunNowHandled(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, trigger string) error {
+	return UpdateStatus(ctx, c, dr, func(status *discoveryv1alpha1.DiscoveryRuleStatus) {
+		status.RunNowTrigger = trigger
+	})
+}
+
+// SetRunFinished writes the result of a discovery rule run and
+// updates the Running and Degraded conditions accordingly.
+// runErr is the error that aborted the run, if any.
+func SetRunFinished(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, stats *RunStats, runErr error) error {
+	rs := stats.RunStatus()
+	return UpdateStatus(ctx, c, dr, func(status *discoveryv1alpha1.DiscoveryRuleStatus) {
+		status.LastRun = rs
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               discoveryv1alpha1.ConditionTypeRunning,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: dr.GetGeneration(),
+			Reason:             "RunFinished",
+			Message:            "waiting for next discovery rule run",
+		})
+		degraded := metav1.Condition{
+			Type:               discoveryv1alpha1.ConditionTypeDegraded,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: dr.GetGeneration(),
+			Reason:             "RunSucceeded",
+			Message:            "last discovery rule run succeeded",
+		}
+		switch {
+		case runErr != nil:
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = "RunFailed"
+			degraded.Message = runErr.Error()
+		case rs != nil && rs.HostsFailed > 0:
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = "DiscoveryFailed"
+			degraded.Message = fmt.Sprintf("discovery failed for %d of %d host(s)", rs.HostsFailed, rs.HostsScanned)
+		}
+		meta.SetStatusCondition(&status.Conditions, degraded)
+	})
+}
+
+// RunAndReport executes a single discovery rule run and
+// reports its result in the discovery rule status.
+func RunAndReport(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule, logger logging.Logger, run func(ctx context.Context, stats *RunStats) error) {
+	// the discoverer profiles are listed once per run
+	ctx = profile_discoverer.WithProfiles(ctx)
+	stats := NewRunStats()
+	err := SetRunStarted(ctx, c, dr)
+	if err != nil {
+		logger.Info("failed to update discovery rule status", "error", err)
+	}
+	runErr := run(ctx, stats)
+	if runErr != nil {
+		logger.Info("failed to run discovery rule", "error", runErr)
+	}
+	// the run result is written even when ctx is done because the rule was stopped,
+	// otherwise the rule would be left running in its status
+	fctx, cancel := context.WithTimeout(context.Background(), runFinishedTimeout)
+	defer cancel()
+	err = SetRunFinished(fctx, c, dr, stats, runErr)
+	if err != nil {
+		logger.Info("failed to update discovery rule status", "error", err)
+	}
+}
@@ -0,0 +1,55 @@
+package discovery_rules
+
+import (
+	"context"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// ctxClient fails the requests issued with a done context, as the API server client does.
+type ctxClient struct {
+	client.Client
+}
+
+func (c *ctxClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestRunAndReportStopped(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := discoveryv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+	}
+	c := &ctxClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(dr).Build()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	RunAndReport(ctx, c, dr, logging.NewNopLogger(), func(ctx context.Context, stats *RunStats) error {
+		// the rule is stopped during the run
+		cancel()
+		return ctx.Err()
+	})
+
+	got := &discoveryv1alpha1.DiscoveryRule{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(dr), got); err != nil {
+		t.Fatal(err)
+	}
+	if meta.IsStatusConditionTrue(got.Status.Conditions, discoveryv1alpha1.ConditionTypeRunning) {
+		t.Error("discovery rule still running after the run was stopped")
+	}
+	if got.Status.LastRun == nil {
+		t.Error("run result not reported")
+	}
+}
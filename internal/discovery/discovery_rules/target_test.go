@@ -0,0 +1,261 @@
+package discovery_rules
+
+import (
+	"context"
+	"testing"
+
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// applyClient emulates server-side apply on top of the fake client, which does not support it.
+// The applied fields are merged into the stored object, the field manager is recorded
+// in its managed fields without a field set and every apply is kept for inspection.
+type applyClient struct {
+	client.Client
+	applies []applyCall
+}
+
+type applyCall struct {
+	target *targetv1.Target
+	force  bool
+}
+
+func (c *applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	po := &client.PatchOptions{}
+	po.ApplyOptions(opts)
+	c.applies = append(c.applies, applyCall{
+		target: obj.(*targetv1.Target).DeepCopy(),
+		force:  po.Force != nil && *po.Force,
+	})
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKeyFromObject(obj)
+	err = c.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+	if kerrors.IsNotFound(err) {
+		err = c.Client.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	stored := &targetv1.Target{}
+	if err := c.Client.Get(ctx, key, stored); err != nil {
+		return err
+	}
+	if appliedFields(stored) == nil {
+		stored.SetManagedFields(append(stored.GetManagedFields(), metav1.ManagedFieldsEntry{
+			Manager:   po.FieldManager,
+			Operation: metav1.ManagedFieldsOperationApply,
+		}))
+		if err := c.Client.Update(ctx, stored); err != nil {
+			return err
+		}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func newApplyClient(t *testing.T, objs ...client.Object) *applyClient {
+	scheme := runtime.NewScheme()
+	if err := targetv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := discoveryv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+}
+
+func TestApplyTargetSyncAll(t *testing.T) {
+	legacy := &targetv1.Target{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "leaf2.def456",
+			Namespace: "default",
+			// targets created before server-side apply only carry the rule name label
+			Labels: map[string]string{discoveryv1alpha1.LabelKeyDiscoveryRule: "dr1"},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "manager", Operation: metav1.ManagedFieldsOperationUpdate},
+			},
+		},
+		Spec: targetv1.TargetSpec{
+			Properties: &targetv1.TargetProperties{
+				VendorType: targetv1.VendorTypeNokiaSRL,
+				Config:     &targetv1.TargetConfig{Address: "10.0.0.2:57400", CredentialName: "old"},
+			},
+			DiscoveryInfo: &targetv1.DiscoveryInfo{HostName: "leaf2", SerialNumber: "DEF456"},
+		},
+	}
+	c := newApplyClient(t, legacy)
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			SyncPolicy: discoveryv1alpha1.SyncPolicyAll,
+		},
+	}
+	tests := []struct {
+		name      string
+		di        *targetv1.DiscoveryInfo
+		tc        *targetv1.TargetConfig
+		wantOp    controllerutil.OperationResult
+		wantForce bool
+	}{
+		{
+			name:   "new target",
+			di:     &targetv1.DiscoveryInfo{VendorType: targetv1.VendorTypeNokiaSRL, HostName: "leaf1", SerialNumber: "ABC123"},
+			tc:     &targetv1.TargetConfig{Address: "10.0.0.1:57400", CredentialName: "new"},
+			wantOp: controllerutil.OperationResultCreated,
+		},
+		{
+			name:      "legacy target adopted",
+			di:        &targetv1.DiscoveryInfo{VendorType: targetv1.VendorTypeNokiaSRL, HostName: "leaf2", SerialNumber: "DEF456", SwVersion: "v22.3"},
+			tc:        &targetv1.TargetConfig{Address: "10.0.0.2:57400", CredentialName: "new"},
+			wantOp:    controllerutil.OperationResultUpdated,
+			wantForce: true,
+		},
+		{
+			name:   "adopted target",
+			di:     &targetv1.DiscoveryInfo{VendorType: targetv1.VendorTypeNokiaSRL, HostName: "leaf2", SerialNumber: "DEF456", SwVersion: "v22.6"},
+			tc:     &targetv1.TargetConfig{Address: "10.0.0.2:57400", CredentialName: "new"},
+			wantOp: controllerutil.OperationResultUpdated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := ApplyTarget(context.Background(), c, dr, tt.di, tt.tc, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op != tt.wantOp {
+				t.Errorf("got operation result %q, want %q", op, tt.wantOp)
+			}
+			applied := c.applies[len(c.applies)-1]
+			if applied.force != tt.wantForce {
+				t.Errorf("got forced apply %t, want %t", applied.force, tt.wantForce)
+			}
+			if applied.target.Spec.Properties.Config.CredentialName != tt.tc.CredentialName {
+				t.Errorf("target config not applied: %+v", applied.target.Spec.Properties.Config)
+			}
+			lbls := applied.target.GetLabels()
+			if lbls[discoveryv1alpha1.LabelKeyDiscoveryRule] != "dr1" || lbls[discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace] != "default" {
+				t.Errorf("ownership labels not applied: %v", lbls)
+			}
+		})
+	}
+}
+
+func TestApplyTargetSyncDiscoveryInfo(t *testing.T) {
+	existing := &targetv1.Target{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "leaf1.abc123",
+			Namespace: "default",
+			Labels:    map[string]string{"site": "site1", "team": "netops"},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{
+					Manager:    discoveryv1alpha1.FieldManager,
+					Operation:  metav1.ManagedFieldsOperationApply,
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:site":{}}}}`)},
+				},
+			},
+		},
+		Spec: targetv1.TargetSpec{
+			Properties: &targetv1.TargetProperties{
+				VendorType: targetv1.VendorTypeNokiaSRL,
+				Config:     &targetv1.TargetConfig{Address: "10.0.0.1:57400", CredentialName: "old"},
+			},
+			DiscoveryInfo: &targetv1.DiscoveryInfo{HostName: "leaf1", SerialNumber: "ABC123", SwVersion: "v21.11"},
+		},
+	}
+	c := newApplyClient(t, existing)
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{
+			SyncPolicy: discoveryv1alpha1.SyncPolicyDiscoveryInfo,
+		},
+	}
+	di := &targetv1.DiscoveryInfo{VendorType: targetv1.VendorTypeNokiaSRL, HostName: "leaf1", SerialNumber: "ABC123", SwVersion: "v22.3"}
+	tc := &targetv1.TargetConfig{Address: "10.0.0.2:57400", CredentialName: "new"}
+
+	op, err := ApplyTarget(context.Background(), c, dr, di, tc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != controllerutil.OperationResultUpdated {
+		t.Errorf("unexpected operation result %q", op)
+	}
+	if len(c.applies) != 1 || c.applies[0].force {
+		t.Fatalf("expected a single apply without force, got %d", len(c.applies))
+	}
+	applied := c.applies[0].target
+	// the labels discovery did not apply are left to their owner
+	if len(applied.Labels) != 1 || applied.Labels["site"] != "site1" {
+		t.Errorf("unexpected applied labels %v", applied.Labels)
+	}
+	got := &targetv1.Target{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "leaf1.abc123"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.DiscoveryInfo.SwVersion != "v22.3" {
+		t.Errorf("discovery info not updated: %+v", got.Spec.DiscoveryInfo)
+	}
+	if got.Spec.Properties.Config.Address != "10.0.0.1:57400" || got.Spec.Properties.Config.CredentialName != "old" {
+		t.Errorf("target config updated with the DiscoveryInfo sync policy: %+v", got.Spec.Properties.Config)
+	}
+	if got.Labels["team"] != "netops" || got.Labels[discoveryv1alpha1.LabelKeyDiscoveryRule] != "" {
+		t.Errorf("target labels updated with the DiscoveryInfo sync policy: %v", got.Labels)
+	}
+}
+
+// enumClient rejects the applied targets with a vendor type
+// not defined by the target API, as a target CRD validating it
+type enumClient struct {
+	*applyClient
+}
+
+func (c *enumClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	t := obj.(*targetv1.Target)
+	if patch.Type() == types.ApplyPatchType && !apiVendorType(t.Spec.Properties.VendorType) {
+		return kerrors.NewInvalid(t.GroupVersionKind().GroupKind(), t.GetName(), field.ErrorList{
+			field.NotSupported(field.NewPath("spec", "properties", "vendorType"), t.Spec.Properties.VendorType,
+				[]string{string(targetv1.VendorTypeUnknown), string(targetv1.VendorTypeNokiaSRL), string(targetv1.VendorTypeNokiaSROS)}),
+		})
+	}
+	return c.applyClient.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyTargetVendorTypeRejected(t *testing.T) {
+	c := &enumClient{applyClient: newApplyClient(t)}
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr1", Namespace: "default"},
+	}
+	di := &targetv1.DiscoveryInfo{VendorType: discoverers.VendorTypeAristaEOS, HostName: "leaf1", SerialNumber: "ABC123"}
+	tc := &targetv1.TargetConfig{Address: "10.0.0.1:6030"}
+
+	op, err := ApplyTarget(context.Background(), c, dr, di, tc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != controllerutil.OperationResultCreated {
+		t.Errorf("unexpected operation result %q", op)
+	}
+	got := &targetv1.Target{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "leaf1.abc123"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.Properties.VendorType != targetv1.VendorTypeUnknown || got.Spec.DiscoveryInfo.VendorType != targetv1.VendorTypeUnknown {
+		t.Errorf("got vendor types %q and %q, want %q", got.Spec.Properties.VendorType, got.Spec.DiscoveryInfo.VendorType, targetv1.VendorTypeUnknown)
+	}
+}
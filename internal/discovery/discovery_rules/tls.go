@@ -0,0 +1,91 @@
+package discovery_rules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	gapi "github.com/karimra/gnmic/api"
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// caCertKey is the key of the CA certificate in a TLS secret, as set by cert-manager
+const caCertKey = "ca.crt"
+
+// getCertificateSecret returns the TLS secret referenced by the discovery rule certificate
+func getCertificateSecret(ctx context.Context, c client.Client, dr *discoveryv1alpha1.DiscoveryRule) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{
+		Namespace: dr.GetNamespace(),
+		Name:      dr.Spec.Certificate,
+	}, secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// tlsCredentialName returns the TLS credential set in the targets discovered by the rule,
+// none with an insecure connection which does not use the certificate.
+func tlsCredentialName(dr *discoveryv1alpha1.DiscoveryRule) string {
+	if dr.Spec.Insecure {
+		return ""
+	}
+	return dr.Spec.Certificate
+}
+
+// certificateOptions writes the CA, certificate and key found in the TLS secret to a
+// temporary directory and returns the target options referencing them, as the gNMI client
+// only loads TLS files. The server name, if set, overrides the name verified in the target
+// certificate. The returned func removes the files and is called once the client is connected.
+func certificateOptions(secret *corev1.Secret, serverName string) ([]gapi.TargetOption, []grpc.DialOption, func(), error) {
+	cert, key := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if (len(cert) > 0) != (len(key) > 0) {
+		return nil, nil, nil, fmt.Errorf("certificate secret %s must hold both %s and %s",
+			secret.GetName(), corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	dir, err := os.MkdirTemp("", "discovery-tls-")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	tOpts := make([]gapi.TargetOption, 0, 3)
+	if ca := secret.Data[caCertKey]; len(ca) > 0 {
+		f, err := writeFile(dir, caCertKey, ca)
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+		tOpts = append(tOpts, gapi.TLSCA(f))
+	}
+	if len(cert) > 0 {
+		certFile, err := writeFile(dir, corev1.TLSCertKey, cert)
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+		keyFile, err := writeFile(dir, corev1.TLSPrivateKeyKey, key)
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+		tOpts = append(tOpts, gapi.TLSCert(certFile), gapi.TLSKey(keyFile))
+	}
+	var dOpts []grpc.DialOption
+	if serverName != "" {
+		// used by the TLS credentials as the server name to verify
+		dOpts = append(dOpts, grpc.WithAuthority(serverName))
+	}
+	return tOpts, dOpts, cleanup, nil
+}
+
+func writeFile(dir, name string, b []byte) (string, error) {
+	f := filepath.Join(dir, name)
+	return f, os.WriteFile(f, b, 0600)
+}
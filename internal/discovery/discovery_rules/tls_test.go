@@ -0,0 +1,129 @@
+package discovery_rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gapi "github.com/karimra/gnmic/api"
+	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCertificateOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       map[string][]byte
+		serverName string
+		wantFiles  map[string]string
+		wantDOpts  int
+		wantErr    bool
+	}{
+		{
+			name: "CA, certificate and key",
+			data: map[string][]byte{
+				caCertKey:               []byte("ca"),
+				corev1.TLSCertKey:       []byte("cert"),
+				corev1.TLSPrivateKeyKey: []byte("key"),
+			},
+			wantFiles: map[string]string{caCertKey: "ca", corev1.TLSCertKey: "cert", corev1.TLSPrivateKeyKey: "key"},
+		},
+		{
+			name:       "CA with server name override",
+			data:       map[string][]byte{caCertKey: []byte("ca")},
+			serverName: "leaf1.example.com",
+			wantFiles:  map[string]string{caCertKey: "ca"},
+			wantDOpts:  1,
+		},
+		{
+			name:    "missing key",
+			data:    map[string][]byte{caCertKey: []byte("ca"), corev1.TLSCertKey: []byte("cert")},
+			wantErr: true,
+		},
+		{
+			name:    "missing certificate",
+			data:    map[string][]byte{corev1.TLSPrivateKeyKey: []byte("key")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+				Data:       tt.data,
+			}
+			tOpts, dOpts, cleanup, err := certificateOptions(secret, tt.serverName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				assertEmptyDir(t, tmp)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dOpts) != tt.wantDOpts {
+				t.Errorf("got %d dial options, want %d", len(dOpts), tt.wantDOpts)
+			}
+			tg, err := gapi.NewTarget(append(tOpts, gapi.Address("10.0.0.1:57400"))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]*string{
+				caCertKey:               tg.Config.TLSCA,
+				corev1.TLSCertKey:       tg.Config.TLSCert,
+				corev1.TLSPrivateKeyKey: tg.Config.TLSKey,
+			}
+			for name, f := range files {
+				want, ok := tt.wantFiles[name]
+				if !ok {
+					if f != nil && *f != "" {
+						t.Errorf("unexpected %s file %s", name, *f)
+					}
+					continue
+				}
+				if f == nil || filepath.Base(*f) != name {
+					t.Errorf("got %s file %v", name, f)
+					continue
+				}
+				b, err := os.ReadFile(*f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != want {
+					t.Errorf("got %s content %q, want %q", name, b, want)
+				}
+			}
+			cleanup()
+			assertEmptyDir(t, tmp)
+		})
+	}
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("TLS files not removed from %s", dir)
+	}
+}
+
+func TestTLSCredentialName(t *testing.T) {
+	dr := &discoveryv1alpha1.DiscoveryRule{
+		Spec: discoveryv1alpha1.DiscoveryRuleSpec{Certificate: "tls"},
+	}
+	if got := tlsCredentialName(dr); got != "tls" {
+		t.Errorf("got TLS credential %q, want tls", got)
+	}
+	dr.Spec.Insecure = true
+	if got := tlsCredentialName(dr); got != "" {
+		t.Errorf("got TLS credential %q for an insecure connection", got)
+	}
+}
@@ -2,7 +2,6 @@ package topology_watch
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	discoveryv1alpha1 "github.com/yndd/discovery/api/v1alpha1"
@@ -10,7 +9,6 @@ import (
 	targetv1 "github.com/yndd/target/apis/target/v1"
 	topologyv1alpha1 "github.com/yndd/topology/apis/topo/v1alpha1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
@@ -23,6 +21,9 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// label of the targets discovered from a topology node, set to the node name
+const labelKeyTopoNode = "topo.yndd.io/node"
+
 func init() {
 	discoveryrules.Register(discoveryrules.TopoWatchDiscoveryRule, func() discoveryrules.DiscoveryRule {
 		return &topoWatch{}
@@ -32,10 +33,13 @@ func init() {
 type topoWatch struct {
 	logger logging.Logger
 	client client.Client
-	stopCh chan struct{}
+	cfn    context.CancelFunc
+	// run now requests, rediscovering all the nodes
+	trigger <-chan string
 }
 
 func (i *topoWatch) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, opts ...discoveryrules.Option) error {
+	ctx, i.cfn = context.WithCancel(ctx)
 	for _, o := range opts {
 		o(i)
 	}
@@ -45,7 +49,7 @@ func (i *topoWatch) Run(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule
 }
 
 func (i *topoWatch) Stop() error {
-	close(i.stopCh)
+	i.cfn()
 	return nil
 }
 
@@ -57,6 +61,10 @@ func (i *topoWatch) SetClient(c client.Client) {
 	i.client = c
 }
 
+func (i *topoWatch) SetTrigger(trigger <-chan string) {
+	i.trigger = trigger
+}
+
 //
 
 func getNodeDynamicInformer(namespace string) (informers.GenericInformer, error) {
@@ -74,14 +82,34 @@ func getNodeDynamicInformer(namespace string) (informers.GenericInformer, error)
 	return informer, nil
 }
 
+// runNodeWatch discovers the nodes on every node change, each event being reported as a run
+// in the rule status. A run now request rediscovers all the nodes known to the informer.
 func (i *topoWatch) runNodeWatch(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) error {
 	nodeInformer, err := getNodeDynamicInformer(dr.Spec.TopologyRule.Namespace)
 	if err != nil {
 		return err
 	}
-	i.stopCh = make(chan struct{})
-	i.runNodeInformer(ctx, dr, i.stopCh, nodeInformer.Informer())
-	return nil
+	s := nodeInformer.Informer()
+	i.runNodeInformer(ctx, dr, ctx.Done(), s)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case runNow := <-i.trigger:
+			i.logger.Info("run now requested", "trigger", runNow)
+			err = discoveryrules.SetRunNowHandled(ctx, i.client, dr, runNow)
+			if err != nil {
+				i.logger.Info("failed to update discovery rule status", "error", err)
+			}
+			if !cache.WaitForCacheSync(ctx.Done(), s.HasSynced) {
+				return ctx.Err()
+			}
+			discoveryrules.RunAndReport(ctx, i.client, dr, i.logger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+				i.discoverAll(ctx, dr, s.GetStore(), stats)
+				return nil
+			})
+		}
+	}
 }
 
 func (i *topoWatch) runNodeInformer(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, stopCh <-chan struct{}, s cache.SharedIndexInformer) {
@@ -89,102 +117,136 @@ func (i *topoWatch) runNodeInformer(ctx context.Context, dr *discoveryv1alpha1.D
 		cache.ResourceEventHandlerFuncs{
 			AddFunc:    i.addNodeHandler(ctx, dr),
 			DeleteFunc: i.deleteNodeHandler(ctx, dr),
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				i.deleteNodeHandler(ctx, dr)(oldObj)
-				i.addNodeHandler(ctx, dr)(newObj)
-			},
+			UpdateFunc: i.updateNodeHandler(ctx, dr),
 		})
-	s.Run(stopCh)
+	go s.Run(stopCh)
 }
 
-func (i *topoWatch) discover(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, n *topologyv1alpha1.Node) error {
-	switch dr.Spec.Protocol {
-	case "snmp":
-		return nil
-	case "netconf":
-		return nil
-	default: // gnmi
-		t, err := discoveryrules.CreateTarget(ctx, dr, i.client, n.Spec.Properties.MgmtIPAddress)
-		if err != nil {
-			return err
-		}
-		i.logger.Info("Creating gNMI client", "IP", t.Config.Name)
-		err = t.CreateGNMIClient(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to create gNMI client: %w", err)
-		}
-		defer t.Close()
-		capRsp, err := t.Capabilities(ctx)
-		if err != nil {
-			return fmt.Errorf("failed capabilities request: %w", err)
+// discoverAll discovers all the nodes in the store
+func (i *topoWatch) discoverAll(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, store cache.Store, stats *discoveryrules.RunStats) {
+	for _, obj := range store.List() {
+		if ctx.Err() != nil {
+			return
 		}
-		discoverer, err := discoveryrules.GetDiscovererGNMI(capRsp)
+		n, err := toNode(obj)
 		if err != nil {
-			return err
+			i.logger.Info("convert failed", "error", err)
+			continue
 		}
-		di, err := discoverer.Discover(ctx, dr, t)
+		err = i.discover(ctx, dr, n, stats)
 		if err != nil {
-			return err
+			i.logger.Info("node discovery failed", "node", n.GetName(), "error", err)
 		}
-		b, _ := json.Marshal(di)
-		i.logger.Info("discovery info", "info", string(b))
-		return discoveryrules.ApplyTarget(ctx, i.client, dr, di, t, map[string]string{"topo.yndd.io/node": n.GetName()})
 	}
 }
 
+func (i *topoWatch) discover(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, n *topologyv1alpha1.Node, stats *discoveryrules.RunStats) error {
+	return discoveryrules.Discover(ctx, i.client, dr, n.Spec.Properties.MgmtIPAddress, map[string]string{labelKeyTopoNode: n.GetName()}, stats, i.logger)
+}
+
+func toNode(obj interface{}) (*topologyv1alpha1.Node, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	n := &topologyv1alpha1.Node{}
+	// https://erwinvaneyk.nl/kubernetes-unstructured-to-typed/
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), n)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
 func (i *topoWatch) addNodeHandler(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) func(interface{}) {
 	return func(obj interface{}) {
-		n := &topologyv1alpha1.Node{}
-		// https://erwinvaneyk.nl/kubernetes-unstructured-to-typed/
-		err := runtime.DefaultUnstructuredConverter.
-			FromUnstructured(obj.(*unstructured.Unstructured).UnstructuredContent(), n)
+		n, err := toNode(obj)
 		if err != nil {
 			i.logger.Info("convert failed", "error", err)
 			return
 		}
-		i.logger.Info("node added", "node", n)
-		err = i.discover(ctx, dr, n)
-		if err != nil {
-			i.logger.Info("node discovery failed", "node", n, "error", err)
-			return
-		}
-		i.logger.Info("node discovered", "node", n)
+		i.logger.Info("node added", "node", n.GetName())
+		discoveryrules.RunAndReport(ctx, i.client, dr, i.logger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+			i.discoverNode(ctx, dr, n, stats)
+			return nil
+		})
 	}
 }
 
-func (i *topoWatch) deleteNodeHandler(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) func(interface{}) {
-	return func(obj interface{}) {
-		n := &topologyv1alpha1.Node{}
-		err := runtime.DefaultUnstructuredConverter.
-			FromUnstructured(obj.(*unstructured.Unstructured).UnstructuredContent(), n)
+func (i *topoWatch) updateNodeHandler(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) func(interface{}, interface{}) {
+	return func(oldObj, newObj interface{}) {
+		o, err := toNode(oldObj)
 		if err != nil {
 			i.logger.Info("convert failed", "error", err)
 			return
 		}
-		i.logger.Info("node deleted", "node", n.GetName())
-		tgList := &targetv1.TargetList{}
-		validatedLabels, err := labels.ValidatedSelectorFromSet(map[string]string{
-			"topo.yndd.io/node": n.GetName(),
-		})
+		n, err := toNode(newObj)
 		if err != nil {
-			i.logger.Info("failed to build label selector", "error", err)
+			i.logger.Info("convert failed", "error", err)
 			return
 		}
-		err = i.client.List(ctx, tgList, &client.ListOptions{
-			LabelSelector: validatedLabels,
+		i.logger.Info("node updated", "node", n.GetName())
+		discoveryrules.RunAndReport(ctx, i.client, dr, i.logger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+			err := i.deleteNodeTargets(ctx, dr, o, stats)
+			if err != nil {
+				return err
+			}
+			i.discoverNode(ctx, dr, n, stats)
+			return nil
 		})
+	}
+}
+
+func (i *topoWatch) deleteNodeHandler(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule) func(interface{}) {
+	return func(obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		n, err := toNode(obj)
 		if err != nil {
-			i.logger.Info("failed to list targets", "error", err)
+			i.logger.Info("convert failed", "error", err)
 			return
 		}
+		i.logger.Info("node deleted", "node", n.GetName())
+		discoveryrules.RunAndReport(ctx, i.client, dr, i.logger, func(ctx context.Context, stats *discoveryrules.RunStats) error {
+			return i.deleteNodeTargets(ctx, dr, n, stats)
+		})
+	}
+}
 
-		for _, tg := range tgList.Items {
-			err = i.client.Delete(ctx, &tg)
-			if err != nil {
-				i.logger.Info("failed to delete target", "name", tg.GetName(), "error", err)
-				continue
-			}
-			i.logger.Info("deleted target", "name", tg.GetName())
+// discoverNode discovers the node, a failed discovery is recorded in stats
+func (i *topoWatch) discoverNode(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, n *topologyv1alpha1.Node, stats *discoveryrules.RunStats) {
+	err := i.discover(ctx, dr, n, stats)
+	if err != nil {
+		i.logger.Info("node discovery failed", "node", n.GetName(), "error", err)
+		return
+	}
+	i.logger.Info("node discovered", "node", n.GetName())
+}
+
+// deleteNodeTargets deletes the targets discovered by the rule from the node
+func (i *topoWatch) deleteNodeTargets(ctx context.Context, dr *discoveryv1alpha1.DiscoveryRule, n *topologyv1alpha1.Node, stats *discoveryrules.RunStats) error {
+	tgList := &targetv1.TargetList{}
+	err := i.client.List(ctx, tgList,
+		client.InNamespace(discoveryrules.GetTargetNamespace(dr)),
+		client.MatchingLabels{
+			discoveryv1alpha1.LabelKeyDiscoveryRule:          dr.GetName(),
+			discoveryv1alpha1.LabelKeyDiscoveryRuleNamespace: dr.GetNamespace(),
+			labelKeyTopoNode: n.GetName(),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list targets: %w", err)
+	}
+
+	for _, tg := range tgList.Items {
+		err = i.client.Delete(ctx, &tg)
+		if err != nil {
+			i.logger.Info("failed to delete target", "name", tg.GetName(), "error", err)
+			continue
 		}
+		stats.TargetDeleted()
+		i.logger.Info("deleted target", "name", tg.GetName())
 	}
+	return nil
 }
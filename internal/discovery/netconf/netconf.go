@@ -0,0 +1,348 @@
+// Package netconf implements a minimal NETCONF over SSH client (RFC 6241, RFC 6242)
+// sufficient to exchange capabilities and retrieve state data during discovery.
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	CapabilityBase10 = "urn:ietf:params:netconf:base:1.0"
+	CapabilityBase11 = "urn:ietf:params:netconf:base:1.1"
+
+	baseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	// end of message delimiter used by the base:1.0 framing
+	endOfMessage = "]]>]]>"
+	// max size of a chunk in the base:1.1 chunked framing
+	maxChunkSize = 4294967295
+)
+
+var ErrSessionClosed = errors.New("netconf session closed")
+
+// ErrAuthFailed is returned by Dial when the SSH handshake fails while authenticating the user,
+// golang.org/x/crypto/ssh does not export its authentication error.
+var ErrAuthFailed = errors.New("SSH authentication failed")
+
+// Session is a NETCONF session established over SSH
+type Session struct {
+	client  *ssh.Client
+	session *ssh.Session
+
+	m       *sync.Mutex
+	r       *bufio.Reader
+	w       io.WriteCloser
+	chunked bool
+	msgID   int
+
+	sessionID          string
+	serverCapabilities []string
+}
+
+// Dial connects to the NETCONF server listening on addr,
+// opens the netconf SSH subsystem and exchanges hello messages.
+func Dial(ctx context.Context, addr string, cfg *ssh.ClientConfig) (*Session, error) {
+	d := net.Dialer{Timeout: cfg.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if cfg.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(cfg.Timeout))
+	}
+	// the user is authenticated once the server host key is accepted
+	var authenticating bool
+	clientCfg := *cfg
+	clientCfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := cfg.HostKeyCallback(hostname, remote, key)
+		authenticating = err == nil
+		return err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &clientCfg)
+	if err != nil {
+		conn.Close()
+		var nErr net.Error
+		if authenticating && !(errors.As(err, &nErr) && nErr.Timeout()) {
+			return nil, fmt.Errorf("%w: %v", ErrAuthFailed, err)
+		}
+		return nil, err
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	s, err := newSession(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	err = s.hello()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	// clear the handshake deadline, RPCs are bound by their context
+	conn.SetDeadline(time.Time{})
+	return s, nil
+}
+
+func newSession(client *ssh.Client) (*Session, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	err = session.RequestSubsystem("netconf")
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &Session{
+		client:  client,
+		session: session,
+		m:       new(sync.Mutex),
+		r:       bufio.NewReader(r),
+		w:       w,
+	}, nil
+}
+
+type hello struct {
+	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id,omitempty"`
+}
+
+func (s *Session) hello() error {
+	b, err := xml.Marshal(&hello{
+		Capabilities: []string{CapabilityBase10, CapabilityBase11},
+	})
+	if err != nil {
+		return err
+	}
+	err = s.writeMsg(append([]byte(xml.Header), b...))
+	if err != nil {
+		return err
+	}
+	rb, err := s.readMsg()
+	if err != nil {
+		return err
+	}
+	srvHello := new(hello)
+	err = xml.Unmarshal(rb, srvHello)
+	if err != nil {
+		return fmt.Errorf("failed to decode server hello: %w", err)
+	}
+	s.sessionID = srvHello.SessionID
+	s.serverCapabilities = make([]string, 0, len(srvHello.Capabilities))
+	for _, c := range srvHello.Capabilities {
+		c = strings.TrimSpace(c)
+		s.serverCapabilities = append(s.serverCapabilities, c)
+		if c == CapabilityBase11 {
+			s.chunked = true
+		}
+	}
+	return nil
+}
+
+// ServerCapabilities returns the capabilities advertised in the server hello
+func (s *Session) ServerCapabilities() []string {
+	return s.serverCapabilities
+}
+
+// SessionID returns the session ID assigned by the server
+func (s *Session) SessionID() string {
+	return s.sessionID
+}
+
+type rpcReply struct {
+	XMLName xml.Name   `xml:"rpc-reply"`
+	Errors  []RPCError `xml:"rpc-error"`
+	Data    struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"data"`
+}
+
+// RPCError is an rpc-error returned by the server
+type RPCError struct {
+	Type     string `xml:"error-type"`
+	Tag      string `xml:"error-tag"`
+	Severity string `xml:"error-severity"`
+	Message  string `xml:"error-message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("netconf rpc-error: type=%s, tag=%s, severity=%s: %s", e.Type, e.Tag, e.Severity, strings.TrimSpace(e.Message))
+}
+
+// Get sends a get RPC with the given subtree filter and returns the content of the data element.
+func (s *Session) Get(ctx context.Context, filter string) ([]byte, error) {
+	var op string
+	if filter == "" {
+		op = "<get/>"
+	} else {
+		op = fmt.Sprintf(`<get><filter type="subtree">%s</filter></get>`, filter)
+	}
+	reply, err := s.RPC(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data.Inner, nil
+}
+
+// RPC sends the operation wrapped in an rpc element and waits for the reply.
+// The session is closed if the context is done before the reply is received.
+func (s *Session) RPC(ctx context.Context, op string) (*rpcReply, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.msgID++
+	req := fmt.Sprintf(`%s<rpc message-id="%d" xmlns="%s">%s</rpc>`, xml.Header, s.msgID, baseNamespace, op)
+
+	type result struct {
+		b   []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		err := s.writeMsg([]byte(req))
+		if err != nil {
+			ch <- result{err: err}
+			return
+		}
+		b, err := s.readMsg()
+		ch <- result{b: b, err: err}
+	}()
+	var res result
+	select {
+	case <-ctx.Done():
+		s.close()
+		return nil, ctx.Err()
+	case res = <-ch:
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	reply := new(rpcReply)
+	err := xml.Unmarshal(res.b, reply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rpc-reply: %w", err)
+	}
+	for _, rpcErr := range reply.Errors {
+		if rpcErr.Severity == "warning" {
+			continue
+		}
+		return nil, &rpcErr
+	}
+	return reply, nil
+}
+
+// Close gracefully closes the NETCONF session and the underlying SSH connection.
+func (s *Session) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.RPC(ctx, "<close-session/>")
+	return s.close()
+}
+
+func (s *Session) close() error {
+	s.session.Close()
+	return s.client.Close()
+}
+
+func (s *Session) writeMsg(b []byte) error {
+	if !s.chunked {
+		_, err := s.w.Write(append(b, []byte(endOfMessage)...))
+		return err
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "\n#%d\n", len(b))
+	buf.Write(b)
+	buf.WriteString("\n##\n")
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+func (s *Session) readMsg() ([]byte, error) {
+	if !s.chunked {
+		return s.readEOM()
+	}
+	return s.readChunks()
+}
+
+// readEOM reads a message framed with the end of message delimiter
+func (s *Session) readEOM() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ErrSessionClosed
+			}
+			return nil, err
+		}
+		buf.WriteByte(c)
+		if c == '>' && bytes.HasSuffix(buf.Bytes(), []byte(endOfMessage)) {
+			return buf.Bytes()[:buf.Len()-len(endOfMessage)], nil
+		}
+	}
+}
+
+// readChunks reads a message framed with the chunked framing
+func (s *Session) readChunks() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for {
+		// each chunk header is LF HASH chunk-size LF,
+		// the end of chunks is LF HASH HASH LF
+		header, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, s.readErr(err)
+		}
+		if header == "\n" {
+			header, err = s.r.ReadString('\n')
+			if err != nil {
+				return nil, s.readErr(err)
+			}
+		}
+		if !strings.HasPrefix(header, "#") {
+			return nil, fmt.Errorf("invalid chunk header %q", header)
+		}
+		header = strings.TrimSuffix(header[1:], "\n")
+		if header == "#" {
+			return buf.Bytes(), nil
+		}
+		size, err := strconv.ParseUint(header, 10, 32)
+		if err != nil || size == 0 || size > maxChunkSize {
+			return nil, fmt.Errorf("invalid chunk size %q", header)
+		}
+		_, err = io.CopyN(buf, s.r, int64(size))
+		if err != nil {
+			return nil, s.readErr(err)
+		}
+	}
+}
+
+func (s *Session) readErr(err error) error {
+	if errors.Is(err, io.EOF) {
+		return ErrSessionClosed
+	}
+	return err
+}
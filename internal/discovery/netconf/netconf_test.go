@@ -0,0 +1,270 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	testUser     = "admin"
+	testPassword = "secret"
+	testData     = `<state xmlns="urn:example:state"><hostname>r1</hostname></state>`
+)
+
+var messageIDRe = regexp.MustCompile(`message-id="([^"]+)"`)
+
+// stubServer is an in-process NETCONF over SSH server answering get RPCs with testData.
+type stubServer struct {
+	t            *testing.T
+	l            net.Listener
+	cfg          *ssh.ServerConfig
+	capabilities []string
+	// rpc-error returned instead of the data, if set
+	rpcError string
+	// received RPCs
+	rpcs chan string
+}
+
+func newStubServer(t *testing.T, capabilities ...string) *stubServer {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == testUser && string(pass) == testPassword {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	cfg.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubServer{
+		t:            t,
+		l:            l,
+		cfg:          cfg,
+		capabilities: capabilities,
+		rpcs:         make(chan string, 10),
+	}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *stubServer) addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *stubServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *stubServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range chReqs {
+				ok := req.Type == "subsystem" && bytes.HasSuffix(req.Payload, []byte("netconf"))
+				req.Reply(ok, nil)
+				if ok {
+					go s.handleSession(ch)
+				}
+			}
+		}()
+	}
+}
+
+func (s *stubServer) handleSession(ch ssh.Channel) {
+	defer ch.Close()
+	r := bufio.NewReader(ch)
+	hello := `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>`
+	for _, c := range s.capabilities {
+		hello += "<capability>" + c + "</capability>"
+	}
+	hello += "</capabilities><session-id>42</session-id></hello>"
+	io.WriteString(ch, hello+endOfMessage)
+
+	ss := &Session{r: r, w: ch}
+	// client hello
+	b, err := ss.readEOM()
+	if err != nil {
+		return
+	}
+	if bytes.Contains(b, []byte(CapabilityBase11)) {
+		for _, c := range s.capabilities {
+			if c == CapabilityBase11 {
+				ss.chunked = true
+			}
+		}
+	}
+	for {
+		b, err := ss.readMsg()
+		if err != nil {
+			return
+		}
+		rpc := string(b)
+		s.rpcs <- rpc
+		var msgID string
+		if m := messageIDRe.FindStringSubmatch(rpc); m != nil {
+			msgID = m[1]
+		}
+		var reply string
+		switch {
+		case strings.Contains(rpc, "<close-session/>"):
+			reply = "<ok/>"
+		case s.rpcError != "":
+			reply = s.rpcError
+		default:
+			reply = "<data>" + testData + "</data>"
+		}
+		err = ss.writeMsg([]byte(fmt.Sprintf(`<rpc-reply xmlns="%s" message-id="%s">%s</rpc-reply>`, baseNamespace, msgID, reply)))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func testClientConfig(password string) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User:            testUser,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+}
+
+func TestSessionGet(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities []string
+		chunked      bool
+	}{
+		{
+			name:         "base 1.0 framing",
+			capabilities: []string{CapabilityBase10, "urn:example:state"},
+		},
+		{
+			name:         "base 1.1 chunked framing",
+			capabilities: []string{CapabilityBase10, CapabilityBase11, "urn:example:state"},
+			chunked:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStubServer(t, tt.capabilities...)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			s, err := Dial(ctx, srv.addr(), testClientConfig(testPassword))
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer s.Close()
+			if s.SessionID() != "42" {
+				t.Errorf("unexpected session ID %q", s.SessionID())
+			}
+			if len(s.ServerCapabilities()) != len(tt.capabilities) {
+				t.Errorf("unexpected server capabilities %v", s.ServerCapabilities())
+			}
+			if s.chunked != tt.chunked {
+				t.Errorf("expected chunked framing %t, got %t", tt.chunked, s.chunked)
+			}
+
+			filter := `<state xmlns="urn:example:state"><hostname/></state>`
+			b, err := s.Get(ctx, filter)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if string(b) != testData {
+				t.Errorf("unexpected data %q", string(b))
+			}
+			rpc := <-srv.rpcs
+			if !strings.Contains(rpc, `<filter type="subtree">`+filter+`</filter>`) {
+				t.Errorf("filter missing from rpc %q", rpc)
+			}
+		})
+	}
+}
+
+func TestSessionRPCError(t *testing.T) {
+	srv := newStubServer(t, CapabilityBase10)
+	srv.rpcError = `<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag>` +
+		`<error-severity>error</error-severity><error-message>boom</error-message></rpc-error>`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := Dial(ctx, srv.addr(), testClientConfig(testPassword))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer s.Close()
+	_, err = s.Get(ctx, "")
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected an RPCError, got %v", err)
+	}
+	if rpcErr.Tag != "operation-failed" || rpcErr.Message != "boom" {
+		t.Errorf("unexpected rpc-error %+v", rpcErr)
+	}
+}
+
+func TestDialAuthFailure(t *testing.T) {
+	srv := newStubServer(t, CapabilityBase10)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := Dial(ctx, srv.addr(), testClientConfig("wrong"))
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("got error %v, want %v", err, ErrAuthFailed)
+	}
+
+	// a host key rejected before authentication is not an authentication failure
+	cfg := testClientConfig(testPassword)
+	cfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return errors.New("unknown host key")
+	}
+	_, err = Dial(ctx, srv.addr(), cfg)
+	if err == nil || errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got error %v, want a host key error", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Package snmp discovers devices using the standard SNMPv2-MIB, LLDP-MIB and ENTITY-MIB objects.
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SNMPv2-MIB
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+	// LLDP-MIB
+	oidLldpLocChassisIDSubtype = "1.0.8802.1.1.2.1.3.1.0"
+	oidLldpLocChassisID        = "1.0.8802.1.1.2.1.3.2.0"
+	// ENTITY-MIB entPhysicalTable columns
+	oidEntPhysicalClass       = "1.3.6.1.2.1.47.1.1.1.1.5"
+	oidEntPhysicalSoftwareRev = "1.3.6.1.2.1.47.1.1.1.1.10"
+	oidEntPhysicalSerialNum   = "1.3.6.1.2.1.47.1.1.1.1.11"
+	oidEntPhysicalModelName   = "1.3.6.1.2.1.47.1.1.1.1.13"
+
+	// entPhysicalClass value of a chassis
+	entPhysicalClassChassis = 3
+	// lldpLocChassisIdSubtype value of a MAC address chassis ID
+	lldpChassisIDSubtypeMAC = 4
+
+	oidEnterprises = "1.3.6.1.4.1."
+)
+
+// private enterprise numbers
+const (
+	enterpriseCisco   = "9"
+	enterpriseJuniper = "2636"
+	enterpriseNokia   = "6527"
+	enterpriseArista  = "30065"
+)
+
+// ErrNoResponse is returned by Discover when the agent does not respond to the first request.
+// SNMPv2c agents silently drop the requests with an unknown community, so it does not tell
+// an unknown community apart from an unreachable agent.
+var ErrNoResponse = errors.New("no response from the SNMP agent")
+
+// ErrAuthorization is returned by Discover when the agent answers the first request
+// with an authorizationError, the community or user is not allowed to read the device.
+var ErrAuthorization = errors.New("SNMP request not authorized")
+
+// Discover queries the agent g is connected to and returns the discovery info of the device.
+func Discover(g *gosnmp.GoSNMP) (*targetv1.DiscoveryInfo, error) {
+	rsp, err := g.Get([]string{oidSysDescr, oidSysObjectID, oidSysName})
+	if err != nil {
+		// gosnmp does not wrap the timeout error
+		if strings.Contains(err.Error(), "timeout") {
+			return nil, fmt.Errorf("%w: %v", ErrNoResponse, err)
+		}
+		return nil, err
+	}
+	if rsp.Error == gosnmp.AuthorizationError {
+		return nil, fmt.Errorf("%w: %v", ErrAuthorization, rsp.Error)
+	}
+	var sysDescr, sysObjectID string
+	di := &targetv1.DiscoveryInfo{
+		LastSeen: metav1.Time{
+			Time: time.Now(),
+		},
+	}
+	for _, v := range rsp.Variables {
+		switch trimOID(v.Name) {
+		case oidSysDescr:
+			sysDescr = toString(v)
+		case oidSysObjectID:
+			sysObjectID = toString(v)
+		case oidSysName:
+			di.HostName = toString(v)
+		}
+	}
+	if sysObjectID == "" {
+		return nil, fmt.Errorf("agent did not return sysObjectID")
+	}
+	di.VendorType = VendorType(sysObjectID, sysDescr)
+
+	di.MacAddress, err = chassisMacAddress(g)
+	if err != nil {
+		return nil, err
+	}
+	err = setChassisInfo(g, di)
+	if err != nil {
+		return nil, err
+	}
+	return di, nil
+}
+
+// VendorType maps the enterprise prefix of the sysObjectID to a vendor type,
+// sysDescr is used to tell apart the operating systems of the same vendor.
+func VendorType(sysObjectID, sysDescr string) targetv1.VendorType {
+	oid := trimOID(sysObjectID)
+	if !strings.HasPrefix(oid, oidEnterprises) {
+		return targetv1.VendorTypeUnknown
+	}
+	enterprise := strings.SplitN(strings.TrimPrefix(oid, oidEnterprises), ".", 2)[0]
+	switch enterprise {
+	case enterpriseNokia:
+		if strings.Contains(sysDescr, "SRLinux") || strings.Contains(sysDescr, "SR Linux") {
+			return targetv1.VendorTypeNokiaSRL
+		}
+		return targetv1.VendorTypeNokiaSROS
+	case enterpriseArista:
+		return discoverers.VendorTypeAristaEOS
+	case enterpriseJuniper:
+		return discoverers.VendorTypeJuniperJunos
+	case enterpriseCisco:
+		switch {
+		case strings.Contains(sysDescr, "IOS XR"):
+			return discoverers.VendorTypeCiscoIOSXR
+		case strings.Contains(sysDescr, "NX-OS"):
+			return discoverers.VendorTypeCiscoNXOS
+		}
+	}
+	return targetv1.VendorTypeUnknown
+}
+
+// chassisMacAddress returns the LLDP chassis ID if it is a MAC address
+func chassisMacAddress(g *gosnmp.GoSNMP) (string, error) {
+	rsp, err := g.Get([]string{oidLldpLocChassisIDSubtype, oidLldpLocChassisID})
+	if err != nil {
+		return "", err
+	}
+	var subtype int64 = -1
+	var chassisID []byte
+	for _, v := range rsp.Variables {
+		switch trimOID(v.Name) {
+		case oidLldpLocChassisIDSubtype:
+			if v.Type == gosnmp.Integer {
+				subtype = gosnmp.ToBigInt(v.Value).Int64()
+			}
+		case oidLldpLocChassisID:
+			if b, ok := v.Value.([]byte); ok {
+				chassisID = b
+			}
+		}
+	}
+	if subtype != lldpChassisIDSubtypeMAC || len(chassisID) != 6 {
+		return "", nil
+	}
+	return net.HardwareAddr(chassisID).String(), nil
+}
+
+// setChassisInfo sets the serial number, platform and software version
+// from the first chassis entry of the ENTITY-MIB entPhysicalTable.
+func setChassisInfo(g *gosnmp.GoSNMP, di *targetv1.DiscoveryInfo) error {
+	walk := g.BulkWalkAll
+	if g.Version == gosnmp.Version1 {
+		walk = g.WalkAll
+	}
+	classes, err := walk(oidEntPhysicalClass)
+	if err != nil {
+		return err
+	}
+	var index string
+	for _, v := range classes {
+		if v.Type == gosnmp.Integer && gosnmp.ToBigInt(v.Value).Int64() == entPhysicalClassChassis {
+			index = strings.TrimPrefix(trimOID(v.Name), oidEntPhysicalClass+".")
+			break
+		}
+	}
+	if index == "" {
+		return nil
+	}
+	rsp, err := g.Get([]string{
+		oidEntPhysicalSerialNum + "." + index,
+		oidEntPhysicalModelName + "." + index,
+		oidEntPhysicalSoftwareRev + "." + index,
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range rsp.Variables {
+		switch strings.TrimSuffix(trimOID(v.Name), "."+index) {
+		case oidEntPhysicalSerialNum:
+			di.SerialNumber = toString(v)
+		case oidEntPhysicalModelName:
+			di.Platform = toString(v)
+		case oidEntPhysicalSoftwareRev:
+			di.SwVersion = toString(v)
+		}
+	}
+	return nil
+}
+
+func trimOID(oid string) string {
+	return strings.TrimPrefix(oid, ".")
+}
+
+// toString returns the value of an OctetString or ObjectIdentifier variable,
+// the empty string for any other type (e.g NoSuchObject)
+func toString(v gosnmp.SnmpPDU) string {
+	switch v.Type {
+	case gosnmp.OctetString:
+		b, ok := v.Value.([]byte)
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	case gosnmp.ObjectIdentifier:
+		s, ok := v.Value.(string)
+		if !ok {
+			return ""
+		}
+		return trimOID(s)
+	}
+	return ""
+}
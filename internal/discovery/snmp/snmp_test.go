@@ -0,0 +1,278 @@
+package snmp
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/yndd/discovery/internal/discovery/discoverers"
+	targetv1 "github.com/yndd/target/apis/target/v1"
+)
+
+const (
+	testCommunity = "public"
+	// community answered with an authorizationError
+	deniedCommunity = "denied"
+)
+
+// stubAgent is a local SNMPv2c agent answering get, get-next and get-bulk requests from a fixed MIB.
+type stubAgent struct {
+	t    *testing.T
+	conn net.PacketConn
+	oids []string
+	mib  map[string]gosnmp.SnmpPDU
+}
+
+func newStubAgent(t *testing.T, pdus ...gosnmp.SnmpPDU) *stubAgent {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &stubAgent{
+		t:    t,
+		conn: conn,
+		mib:  make(map[string]gosnmp.SnmpPDU, len(pdus)),
+	}
+	for _, pdu := range pdus {
+		a.oids = append(a.oids, pdu.Name)
+		a.mib[pdu.Name] = pdu
+	}
+	sort.Slice(a.oids, func(i, j int) bool { return compareOIDs(a.oids[i], a.oids[j]) < 0 })
+	go a.serve()
+	t.Cleanup(func() { conn.Close() })
+	return a
+}
+
+func (a *stubAgent) port() uint16 {
+	return uint16(a.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func (a *stubAgent) serve() {
+	dec := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: testCommunity}
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := dec.SnmpDecodePacket(buf[:n])
+		if err != nil || (req.Community != testCommunity && req.Community != deniedCommunity) {
+			continue
+		}
+		rsp := &gosnmp.SnmpPacket{
+			Version:   req.Version,
+			Community: req.Community,
+			PDUType:   gosnmp.GetResponse,
+			RequestID: req.RequestID,
+		}
+		if req.Community == deniedCommunity {
+			rsp.Error = gosnmp.AuthorizationError
+			req.Variables = nil
+		}
+		for _, v := range req.Variables {
+			name := "." + strings.TrimPrefix(v.Name, ".")
+			switch req.PDUType {
+			case gosnmp.GetRequest:
+				pdu, ok := a.mib[name]
+				if !ok {
+					pdu = gosnmp.SnmpPDU{Name: name, Type: gosnmp.NoSuchObject}
+				}
+				rsp.Variables = append(rsp.Variables, pdu)
+			case gosnmp.GetNextRequest:
+				rsp.Variables = append(rsp.Variables, a.next(name, 1)...)
+			case gosnmp.GetBulkRequest:
+				rsp.Variables = append(rsp.Variables, a.next(name, int(req.MaxRepetitions))...)
+			}
+		}
+		b, err := rsp.MarshalMsg()
+		if err != nil {
+			a.t.Errorf("failed to marshal response: %v", err)
+			return
+		}
+		a.conn.WriteTo(b, addr)
+	}
+}
+
+// next returns up to n variables following oid in lexicographic order
+func (a *stubAgent) next(oid string, n int) []gosnmp.SnmpPDU {
+	pdus := make([]gosnmp.SnmpPDU, 0, n)
+	for _, o := range a.oids {
+		if compareOIDs(o, oid) <= 0 {
+			continue
+		}
+		pdus = append(pdus, a.mib[o])
+		if len(pdus) == n {
+			return pdus
+		}
+	}
+	return append(pdus, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.EndOfMibView})
+}
+
+func compareOIDs(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "."), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x != y {
+			return x - y
+		}
+	}
+	return len(as) - len(bs)
+}
+
+func octetString(oid, s string) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.OctetString, Value: []byte(s)}
+}
+
+func integer(oid string, i int) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.Integer, Value: i}
+}
+
+func TestDiscover(t *testing.T) {
+	agent := newStubAgent(t,
+		octetString(oidSysDescr, "Arista Networks EOS version 4.28.0F running on an Arista Networks DCS-7050SX3-48YC8"),
+		gosnmp.SnmpPDU{Name: "." + oidSysObjectID, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.30065.1.3011.7050.3741.48"},
+		octetString(oidSysName, "leaf1"),
+		integer(oidLldpLocChassisIDSubtype, lldpChassisIDSubtypeMAC),
+		gosnmp.SnmpPDU{Name: "." + oidLldpLocChassisID, Type: gosnmp.OctetString, Value: []byte{0x00, 0x1c, 0x73, 0xaa, 0xbb, 0xcc}},
+		// a module entry sorting before the chassis entry
+		integer(oidEntPhysicalClass+".1", 9),
+		integer(oidEntPhysicalClass+".100", entPhysicalClassChassis),
+		octetString(oidEntPhysicalSoftwareRev+".100", "4.28.0F"),
+		octetString(oidEntPhysicalSerialNum+".1", "MODULE-SERIAL"),
+		octetString(oidEntPhysicalSerialNum+".100", "JPE12345678"),
+		octetString(oidEntPhysicalModelName+".100", "DCS-7050SX3-48YC8"),
+	)
+	g := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      agent.port(),
+		Version:   gosnmp.Version2c,
+		Community: testCommunity,
+		Timeout:   2 * time.Second,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if err := g.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Conn.Close()
+
+	di, err := Discover(g)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	expected := targetv1.DiscoveryInfo{
+		VendorType:   discoverers.VendorTypeAristaEOS,
+		HostName:     "leaf1",
+		Platform:     "DCS-7050SX3-48YC8",
+		MacAddress:   "00:1c:73:aa:bb:cc",
+		SerialNumber: "JPE12345678",
+		SwVersion:    "4.28.0F",
+	}
+	di.LastSeen = expected.LastSeen
+	if !reflect.DeepEqual(*di, expected) {
+		t.Errorf("unexpected discovery info\n got: %+v\nwant: %+v", *di, expected)
+	}
+}
+
+func TestDiscoverNoResponse(t *testing.T) {
+	agent := newStubAgent(t, octetString(oidSysName, "leaf1"))
+	g := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      agent.port(),
+		Version:   gosnmp.Version2c,
+		Community: "unknown",
+		Timeout:   100 * time.Millisecond,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if err := g.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Conn.Close()
+
+	_, err := Discover(g)
+	if !errors.Is(err, ErrNoResponse) {
+		t.Errorf("got error %v, want %v", err, ErrNoResponse)
+	}
+}
+
+func TestDiscoverAuthorizationError(t *testing.T) {
+	agent := newStubAgent(t, octetString(oidSysName, "leaf1"))
+	g := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      agent.port(),
+		Version:   gosnmp.Version2c,
+		Community: deniedCommunity,
+		Timeout:   time.Second,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if err := g.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Conn.Close()
+
+	_, err := Discover(g)
+	if !errors.Is(err, ErrAuthorization) {
+		t.Errorf("got error %v, want %v", err, ErrAuthorization)
+	}
+}
+
+func TestDiscoverWithoutEntityMIB(t *testing.T) {
+	agent := newStubAgent(t,
+		octetString(oidSysDescr, "Juniper Networks, Inc. qfx5120-48y-8c"),
+		gosnmp.SnmpPDU{Name: "." + oidSysObjectID, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.2636.1.1.1.2.151"},
+		octetString(oidSysName, "spine1"),
+	)
+	g := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      agent.port(),
+		Version:   gosnmp.Version2c,
+		Community: testCommunity,
+		Timeout:   2 * time.Second,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if err := g.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Conn.Close()
+
+	di, err := Discover(g)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if di.VendorType != discoverers.VendorTypeJuniperJunos || di.HostName != "spine1" {
+		t.Errorf("unexpected discovery info %+v", *di)
+	}
+	if di.SerialNumber != "" || di.MacAddress != "" {
+		t.Errorf("expected no serial number and MAC address, got %+v", *di)
+	}
+}
+
+func TestVendorType(t *testing.T) {
+	tests := []struct {
+		sysObjectID string
+		sysDescr    string
+		want        targetv1.VendorType
+	}{
+		{".1.3.6.1.4.1.6527.1.3.17", "TiMOS-B-22.2.R1 both/x86_64 Nokia 7750 SR", targetv1.VendorTypeNokiaSROS},
+		{"1.3.6.1.4.1.6527.1.20.1", "SRLinux-v22.3.1 7220 IXR-D2", targetv1.VendorTypeNokiaSRL},
+		{"1.3.6.1.4.1.30065.1.3011.7050", "Arista Networks EOS", discoverers.VendorTypeAristaEOS},
+		{"1.3.6.1.4.1.2636.1.1.1.2.29", "Juniper Networks, Inc. mx240", discoverers.VendorTypeJuniperJunos},
+		{"1.3.6.1.4.1.9.1.2264", "Cisco IOS XR Software (NCS-5500), Version 7.3.2", discoverers.VendorTypeCiscoIOSXR},
+		{"1.3.6.1.4.1.9.12.3.1.3.1812", "Cisco NX-OS(tm) nxos.9.3.8.bin", discoverers.VendorTypeCiscoNXOS},
+		{"1.3.6.1.4.1.9.1.1208", "Cisco IOS Software, C2960 Software", targetv1.VendorTypeUnknown},
+		{"1.3.6.1.4.1.8072.3.2.10", "Linux", targetv1.VendorTypeUnknown},
+		{"1.3.6.1.2.1.1", "", targetv1.VendorTypeUnknown},
+	}
+	for _, tt := range tests {
+		if got := VendorType(tt.sysObjectID, tt.sysDescr); got != tt.want {
+			t.Errorf("VendorType(%q, %q) = %q, want %q", tt.sysObjectID, tt.sysDescr, got, tt.want)
+		}
+	}
+}